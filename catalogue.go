@@ -0,0 +1,351 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/telebot.v3"
+
+	"transferin-drama/database"
+	"transferin-drama/models"
+)
+
+const (
+	catalogPageSize   = 8
+	partGridColumns   = 5
+	partGridPageSize  = 30
+	catalogTagsLimit  = 30
+	maxCatalogTagData = 40 // callback data Telegram maksimal 64 byte
+)
+
+// Catalogue orders.
+const (
+	catalogNewest = "new"
+	catalogAZ     = "az"
+	catalogTag    = "tag"
+)
+
+// catalogQuery is one page of the catalogue. It travels in the callback
+// data of the catalogue buttons.
+type catalogQuery struct {
+	Sort string
+	Tag  string
+	Page int
+}
+
+func (q catalogQuery) data() string {
+	return fmt.Sprintf("%s|%d|%s", q.Sort, q.Page, q.Tag)
+}
+
+func parseCatalogQuery(data string) catalogQuery {
+	q := catalogQuery{Sort: catalogNewest}
+	parts := strings.SplitN(data, "|", 3)
+	if parts[0] == catalogAZ || parts[0] == catalogTag {
+		q.Sort = parts[0]
+	}
+	if len(parts) > 1 {
+		q.Page, _ = strconv.Atoi(parts[1])
+	}
+	if len(parts) > 2 {
+		q.Tag = parts[2]
+	}
+	if q.Sort == catalogTag && q.Tag == "" {
+		q.Sort = catalogNewest
+	}
+	return q
+}
+
+// dramaTags splits the comma separated tags of a drama.
+func dramaTags(d *models.Drama) []string {
+	var tags []string
+	for _, t := range strings.Split(d.Tag, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// handleCatalog shows a page of dramas:
+//
+//	/katalog
+func handleCatalog(c telebot.Context) error {
+	q := catalogQuery{Sort: catalogNewest}
+	if c.Callback() != nil {
+		_ = c.Respond()
+		if c.Callback().Unique == "catalog" {
+			q = parseCatalogQuery(c.Data())
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	sort := bson.D{{Key: "_id", Value: -1}}
+	switch q.Sort {
+	case catalogAZ:
+		sort = bson.D{{Key: "title", Value: 1}}
+	case catalogTag:
+		// Cocokkan satu tag utuh di daftar yang dipisah koma
+		filter["tag"] = primitive.Regex{
+			Pattern: `(^|,)\s*` + regexp.QuoteMeta(q.Tag) + `\s*(,|$)`,
+			Options: "i",
+		}
+		sort = bson.D{{Key: "title", Value: 1}}
+	}
+
+	col := database.GetDramaCollection()
+	total, err := col.CountDocuments(ctx, filter)
+	if err != nil {
+		log.Println("❌ Gagal menghitung katalog:", err)
+		return c.Send("❌ Gagal memuat katalog. Coba beberapa saat lagi.")
+	}
+	pages := int((total + catalogPageSize - 1) / catalogPageSize)
+	if q.Page >= pages {
+		q.Page = pages - 1
+	}
+	if q.Page < 0 {
+		q.Page = 0
+	}
+
+	cursor, err := col.Find(ctx, filter, options.Find().
+		SetSort(sort).
+		SetSkip(int64(q.Page*catalogPageSize)).
+		SetLimit(catalogPageSize).
+		SetProjection(bson.M{"title": 1, "total_part": 1}))
+	var dramas []models.Drama
+	if err == nil {
+		err = cursor.All(ctx, &dramas)
+	}
+	if err != nil {
+		log.Println("❌ Gagal mengambil katalog:", err)
+		return c.Send("❌ Gagal memuat katalog. Coba beberapa saat lagi.")
+	}
+
+	menu := &telebot.ReplyMarkup{}
+	sortBtn := func(text, sort string) telebot.Btn {
+		if q.Sort == sort {
+			text = "• " + text + " •"
+		}
+		return menu.Data(text, "catalog", catalogQuery{Sort: sort}.data())
+	}
+	rows := []telebot.Row{menu.Row(
+		sortBtn("🆕 Terbaru", catalogNewest),
+		sortBtn("🔤 A–Z", catalogAZ),
+		menu.Data("🏷️ Tag", "catalog_tags"),
+	)}
+	for _, d := range dramas {
+		rows = append(rows, menu.Row(menu.Data(
+			fmt.Sprintf("🎬 %s (%d part)", d.Title, d.TotalPart), "drama", d.ID.Hex(),
+		)))
+	}
+	if nav := pageNav(menu, "catalog", q.Page, pages, func(page int) string {
+		next := q
+		next.Page = page
+		return next.data()
+	}); nav != nil {
+		rows = append(rows, nav)
+	}
+	rows = append(rows, menu.Row(backBtn))
+	menu.Inline(rows...)
+
+	var msg strings.Builder
+	msg.WriteString("🎬 <b>Katalog Drama DRAMATRANS</b>\n\n")
+	switch q.Sort {
+	case catalogAZ:
+		msg.WriteString("Urutan: A–Z\n")
+	case catalogTag:
+		msg.WriteString(fmt.Sprintf("Tag: <b>%s</b>\n", html.EscapeString(q.Tag)))
+	default:
+		msg.WriteString("Urutan: terbaru\n")
+	}
+	if total == 0 {
+		msg.WriteString("\nBelum ada drama di sini.")
+	} else {
+		msg.WriteString(fmt.Sprintf("Total %d drama. Pilih judul untuk melihat daftar part.\n", total))
+	}
+	msg.WriteString("\n🔐 <b>Part VIP</b> hanya untuk yang sudah berlangganan\n❓ Ada pertanyaan? Hubungi admin: @domi_nuc")
+
+	if c.Callback() != nil {
+		return c.Edit(msg.String(), menu, telebot.ModeHTML)
+	}
+	return c.Send(msg.String(), menu, telebot.ModeHTML)
+}
+
+// pageNav builds the previous/next row of a paginated list, or nil when
+// everything fits on one page.
+func pageNav(menu *telebot.ReplyMarkup, unique string, page, pages int, data func(page int) string) telebot.Row {
+	if pages <= 1 {
+		return nil
+	}
+	var row telebot.Row
+	if page > 0 {
+		row = append(row, menu.Data("⬅️", unique, data(page-1)))
+	}
+	row = append(row, menu.Data(fmt.Sprintf("%d/%d", page+1, pages), "noop"))
+	if page < pages-1 {
+		row = append(row, menu.Data("➡️", unique, data(page+1)))
+	}
+	return row
+}
+
+// handleCatalogTags lists the tags dramas can be browsed by.
+func handleCatalogTags(c telebot.Context) error {
+	_ = c.Respond()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := database.GetDramaCollection().Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"tag": bson.M{"$nin": bson.A{"", nil}}}}},
+		{{Key: "$project", Value: bson.M{"tags": bson.M{"$split": bson.A{"$tag", ","}}}}},
+		{{Key: "$unwind", Value: "$tags"}},
+		{{Key: "$project", Value: bson.M{"tag": bson.M{"$trim": bson.M{"input": "$tags"}}}}},
+		{{Key: "$match", Value: bson.M{"tag": bson.M{"$ne": ""}}}},
+		{{Key: "$group", Value: bson.M{"_id": bson.M{"$toLower": "$tag"}, "tag": bson.M{"$first": "$tag"}, "count": bson.M{"$sum": 1}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$limit", Value: catalogTagsLimit}},
+	})
+	var tags []struct {
+		Tag   string `bson:"tag"`
+		Count int    `bson:"count"`
+	}
+	if err == nil {
+		err = cursor.All(ctx, &tags)
+	}
+	if err != nil {
+		log.Println("❌ Gagal mengambil tag drama:", err)
+		return c.Send("❌ Gagal memuat tag. Coba beberapa saat lagi.")
+	}
+
+	menu := &telebot.ReplyMarkup{}
+	var rows []telebot.Row
+	var row telebot.Row
+	for _, t := range tags {
+		if len(t.Tag) > maxCatalogTagData {
+			continue
+		}
+		row = append(row, menu.Data(fmt.Sprintf("%s (%d)", t.Tag, t.Count), "catalog", catalogQuery{Sort: catalogTag, Tag: t.Tag}.data()))
+		if len(row) == 2 {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+	rows = append(rows, menu.Row(menu.Data("🔙 Katalog", "catalog", catalogQuery{Sort: catalogNewest}.data())))
+	menu.Inline(rows...)
+
+	msg := "🏷️ <b>Pilih Tag</b>"
+	if len(tags) == 0 {
+		msg = "🏷️ Belum ada drama yang diberi tag."
+	}
+	return c.Edit(msg, menu, telebot.ModeHTML)
+}
+
+func getDramaByID(ctx context.Context, hexID string) (*models.Drama, error) {
+	id, err := primitive.ObjectIDFromHex(hexID)
+	if err != nil {
+		return nil, err
+	}
+	var d models.Drama
+	if err := database.GetDramaCollection().FindOne(ctx, bson.M{"_id": id}).Decode(&d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// handleDramaDetail shows a drama with a grid of its parts.
+func handleDramaDetail(c telebot.Context) error {
+	_ = c.Respond()
+
+	hexID, pageData, _ := strings.Cut(c.Data(), "|")
+	page, _ := strconv.Atoi(pageData)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	d, err := getDramaByID(ctx, hexID)
+	if err != nil {
+		return c.Send("❌ Drama tidak ditemukan.")
+	}
+
+	var msg strings.Builder
+	msg.WriteString(fmt.Sprintf("🎬 <b>%s</b>\n\n", html.EscapeString(d.Title)))
+	msg.WriteString(fmt.Sprintf("🎞️ Total: %d part\n", d.TotalPart))
+	if d.Cast != "" {
+		msg.WriteString(fmt.Sprintf("🎭 Pemeran: %s\n", html.EscapeString(d.Cast)))
+	}
+	if tags := dramaTags(d); len(tags) > 0 {
+		msg.WriteString(fmt.Sprintf("🏷️ Tag: %s\n", html.EscapeString(strings.Join(tags, ", "))))
+	}
+	msg.WriteString(fmt.Sprintf("\n🆓 %d part pertama gratis, sisanya khusus VIP.\nPilih part untuk mulai nonton:", freePartsPerDrama()))
+
+	pages := (d.TotalPart + partGridPageSize - 1) / partGridPageSize
+	if page >= pages {
+		page = pages - 1
+	}
+	if page < 0 {
+		page = 0
+	}
+
+	menu := &telebot.ReplyMarkup{}
+	var rows []telebot.Row
+	var row telebot.Row
+	first := page*partGridPageSize + 1
+	for part := first; part <= d.TotalPart && part < first+partGridPageSize; part++ {
+		label := strconv.Itoa(part)
+		if isFreePart(part) {
+			label = "🆓 " + label
+		}
+		row = append(row, menu.Data(label, "drama_part", fmt.Sprintf("%s|%d", hexID, part)))
+		if len(row) == partGridColumns {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+	if nav := pageNav(menu, "drama", page, pages, func(page int) string {
+		return fmt.Sprintf("%s|%d", hexID, page)
+	}); nav != nil {
+		rows = append(rows, nav)
+	}
+	rows = append(rows, menu.Row(menu.Data("🔙 Katalog", "catalog", catalogQuery{Sort: catalogNewest}.data())))
+	menu.Inline(rows...)
+
+	return c.Edit(msg.String(), menu, telebot.ModeHTML)
+}
+
+// handleDramaPart sends the picked part through the usual video path.
+func handleDramaPart(c telebot.Context) error {
+	_ = c.Respond()
+
+	hexID, partData, _ := strings.Cut(c.Data(), "|")
+	part, err := strconv.Atoi(partData)
+	if err != nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	d, err := getDramaByID(ctx, hexID)
+	if err != nil {
+		return c.Send("❌ Drama tidak ditemukan.")
+	}
+	return sendVideo(c, fmt.Sprintf("%s_part_%d", d.Slug, part))
+}
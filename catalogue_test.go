@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestParseCatalogQuery(t *testing.T) {
+	tests := []struct {
+		data string
+		want catalogQuery
+	}{
+		{"", catalogQuery{Sort: catalogNewest}},
+		{"new|2|", catalogQuery{Sort: catalogNewest, Page: 2}},
+		{"az|0|", catalogQuery{Sort: catalogAZ}},
+		{"tag|1|Romansa", catalogQuery{Sort: catalogTag, Tag: "Romansa", Page: 1}},
+		// Tag boleh berisi "|" karena hanya dipecah menjadi tiga bagian
+		{"tag|0|Aksi|Drama", catalogQuery{Sort: catalogTag, Tag: "Aksi|Drama"}},
+		// Urutan tag tanpa tag kembali ke terbaru
+		{"tag|3|", catalogQuery{Sort: catalogNewest, Page: 3}},
+		{"acak|x|", catalogQuery{Sort: catalogNewest}},
+	}
+	for _, tt := range tests {
+		if got := parseCatalogQuery(tt.data); got != tt.want {
+			t.Errorf("parseCatalogQuery(%q) = %+v, want %+v", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestCatalogQueryRoundTrip(t *testing.T) {
+	for _, q := range []catalogQuery{
+		{Sort: catalogNewest, Page: 4},
+		{Sort: catalogAZ},
+		{Sort: catalogTag, Tag: "Balas Dendam", Page: 1},
+	} {
+		if got := parseCatalogQuery(q.data()); got != q {
+			t.Errorf("parseCatalogQuery(%q) = %+v, want %+v", q.data(), got, q)
+		}
+	}
+}
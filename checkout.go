@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"gopkg.in/telebot.v3"
+
+	"transferin-drama/models"
+)
+
+// checkoutOrder is what the buyer picked before the QRIS is generated. It
+// travels in the callback data of the checkout buttons.
+type checkoutOrder struct {
+	Package   string
+	Voucher   string
+	Recipient int64 // penerima hadiah, 0 = untuk diri sendiri
+}
+
+func (o checkoutOrder) data() string {
+	return fmt.Sprintf("%s|%s|%d", o.Package, o.Voucher, o.Recipient)
+}
+
+func parseCheckoutOrder(data string) checkoutOrder {
+	parts := strings.SplitN(data, "|", 3)
+	order := checkoutOrder{Package: parts[0]}
+	if len(parts) > 1 {
+		order.Voucher = parts[1]
+	}
+	if len(parts) > 2 {
+		order.Recipient, _ = strconv.ParseInt(parts[2], 10, 64)
+	}
+	return order
+}
+
+// handleCheckout shows the chosen package with the option to apply a voucher
+// or gift it before the QRIS is generated.
+func handleCheckout(c telebot.Context) error {
+	return showCheckout(c, parseCheckoutOrder(c.Data()))
+}
+
+func showCheckout(c telebot.Context, order checkoutOrder) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	pkg, err := getPackage(ctx, order.Package)
+	if err != nil || !pkg.Active {
+		return c.Send("❌ Paket VIP tidak ditemukan.")
+	}
+
+	p := message.NewPrinter(language.Indonesian)
+	now := GetJakartaTime()
+	price := pkg.PriceAt(now)
+	amount := price
+	starsPrice := pkg.StarsPriceAt(now, starsIDRRate())
+	stars := starsPrice
+
+	var msg strings.Builder
+	msg.WriteString("🛒 <b>Checkout Paket VIP</b>\n\n")
+	msg.WriteString(fmt.Sprintf("📦 Paket: %s\n", pkg.Label))
+	msg.WriteString(fmt.Sprintf("🔐 Durasi: %d hari\n", pkg.Days))
+
+	recipient, err := orderRecipient(ctx, order, c.Sender().ID)
+	if err != nil {
+		return c.Send(giftRecipientErrorText(err))
+	}
+	if recipient != nil {
+		msg.WriteString(fmt.Sprintf("🎁 Hadiah untuk: <b>%s</b>\n", html.EscapeString(giftRecipientName(recipient))))
+	}
+
+	if order.Voucher != "" {
+		v, err := checkVoucher(ctx, order.Voucher, pkg.Code, c.Sender().ID)
+		if err != nil {
+			return c.Send(voucherErrorText(err))
+		}
+		var bonusDays int
+		amount, bonusDays = v.Apply(price, voucherMinAmount)
+		stars, _ = v.ApplyStars(starsPrice, starsIDRRate(), 1)
+		msg.WriteString(fmt.Sprintf("🎟️ Voucher: <code>%s</code>\n", v.Code))
+		if amount < price {
+			msg.WriteString(p.Sprintf("💸 Potongan: Rp %d\n", price-amount))
+		}
+		if bonusDays > 0 {
+			msg.WriteString(fmt.Sprintf("🎁 Bonus: +%d hari\n", bonusDays))
+		}
+	}
+	msg.WriteString(p.Sprintf("\n💲 Total: <b>Rp %d</b>", amount))
+
+	reply := &telebot.ReplyMarkup{}
+	rows := []telebot.Row{
+		reply.Row(reply.Data(p.Sprintf("💳 Bayar Rp %d (QRIS)", amount), "pay_vip", order.data())),
+		reply.Row(reply.Data(fmt.Sprintf("⭐ Bayar %d Telegram Stars", stars), "pay_stars", order.data())),
+	}
+	if order.Voucher == "" {
+		rows = append(rows, reply.Row(reply.Data("🎟️ Punya kode voucher?", "voucher_enter", order.data())))
+	}
+	if order.Recipient == 0 {
+		rows = append(rows, reply.Row(reply.Data("🎁 Hadiahkan ke teman", "gift_enter", order.data())))
+	}
+	rows = append(rows, reply.Row(vipBtn))
+	reply.Inline(rows...)
+
+	if c.Callback() != nil {
+		return c.Edit(msg.String(), reply, telebot.ModeHTML)
+	}
+	return c.Send(msg.String(), reply, telebot.ModeHTML)
+}
+
+// handlePayVIP generates the QRIS for a checkout.
+func handlePayVIP(c telebot.Context) error {
+	_ = c.Respond()
+	return sendQris(c, parseCheckoutOrder(c.Data()))
+}
+
+// handleVoucherEnter and handleGiftEnter keep the order being built in a
+// conversation while the bot waits for the voucher code or gift recipient.
+func handleVoucherEnter(c telebot.Context) error {
+	_ = c.Respond()
+	if err := startConversation(c.Sender().ID, flowVoucher, "", map[string]string{"order": c.Data()}); err != nil {
+		return c.Send("❌ Terjadi kesalahan. Coba beberapa saat lagi.")
+	}
+	return conversationPrompt(c, "🎟️ Kirim kode voucher kamu sekarang.")
+}
+
+func handleGiftEnter(c telebot.Context) error {
+	_ = c.Respond()
+	if err := startConversation(c.Sender().ID, flowGift, "", map[string]string{"order": c.Data()}); err != nil {
+		return c.Send("❌ Terjadi kesalahan. Coba beberapa saat lagi.")
+	}
+	return conversationPrompt(c, "🎁 Siapa penerima hadiahnya?\n\n"+
+		"Teruskan (forward) salah satu pesan teman kamu ke sini, atau kirim @username / user ID-nya.\n"+
+		"Teman kamu harus sudah pernah memulai bot ini.")
+}
+
+func handleVoucherText(c telebot.Context, conv *models.Conversation) error {
+	order := parseCheckoutOrder(conv.Data["order"])
+	code := strings.ToUpper(strings.TrimSpace(c.Text()))
+	if !voucherCodePattern.MatchString(code) {
+		return resumeConversation(c, conv, "❌ Kode voucher tidak ditemukan.")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := checkVoucher(ctx, code, order.Package, c.Sender().ID); err != nil {
+		return resumeConversation(c, conv, voucherErrorText(err))
+	}
+	order.Voucher = code
+	return showCheckout(c, order)
+}
+
+func handleGiftText(c telebot.Context, conv *models.Conversation) error {
+	order := parseCheckoutOrder(conv.Data["order"])
+	recipientID, err := giftRecipientFromMessage(c)
+	if err != nil {
+		return resumeConversation(c, conv, giftRecipientErrorText(err))
+	}
+	order.Recipient = recipientID
+	return showCheckout(c, order)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/telebot.v3"
+
+	"transferin-drama/database"
+	"transferin-drama/models"
+)
+
+// conversationTTL is how long the bot keeps waiting for the next step of a
+// conversation before forgetting it.
+const conversationTTL = 10 * time.Minute
+
+// Conversation flows.
+const (
+	flowReferral = "referral"
+	flowVoucher  = "voucher"
+	flowGift     = "gift"
+	flowSearch   = "search"
+)
+
+// conversationHandler handles the text message a flow was waiting for. The
+// conversation has already been ended; a handler that needs more input
+// starts it again with startConversation.
+type conversationHandler func(c telebot.Context, conv *models.Conversation) error
+
+var conversationFlows = map[string]conversationHandler{
+	flowReferral: handleReferralText,
+	flowVoucher:  handleVoucherText,
+	flowGift:     handleGiftText,
+	flowSearch:   handleSearchText,
+}
+
+var cancelConversationBtn = telebot.Btn{Text: "❌ Batal", Unique: "conv_cancel"}
+
+// startConversation makes the user's next text message go to flow,
+// replacing any conversation that was still open.
+func startConversation(userID int64, flow, step string, data map[string]string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := GetJakartaTime()
+	_, err := database.GetConversationCollection().ReplaceOne(ctx,
+		bson.M{"telegramID": userID},
+		models.Conversation{
+			TelegramID: userID,
+			Flow:       flow,
+			Step:       step,
+			Data:       data,
+			ExpiresAt:  now.Add(conversationTTL),
+			UpdatedAt:  now,
+		},
+		options.Replace().SetUpsert(true),
+	)
+	if err != nil {
+		log.Printf("❌ Failed to start %s conversation for %d: %v", flow, userID, err)
+	}
+	return err
+}
+
+// takeConversation ends and returns the user's open conversation, or nil if
+// there is none. Taking it atomically means a message is handled by exactly
+// one step even when the user sends several at once; a step that rejects
+// the input puts it back with resumeConversation.
+func takeConversation(ctx context.Context, userID int64) (*models.Conversation, error) {
+	var conv models.Conversation
+	err := database.GetConversationCollection().FindOneAndDelete(ctx, bson.M{
+		"telegramID": userID,
+		// The TTL index only sweeps about once a minute
+		"expires_at": bson.M{"$gt": GetJakartaTime()},
+	}).Decode(&conv)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &conv, nil
+}
+
+// resumeConversation puts conv back after its input was rejected, so a typo
+// does not end the flow, and tells the user why.
+func resumeConversation(c telebot.Context, conv *models.Conversation, text string) error {
+	if err := startConversation(conv.TelegramID, conv.Flow, conv.Step, conv.Data); err != nil {
+		return c.Send(text)
+	}
+	return conversationPrompt(c, text+"\n\nKirim lagi, atau tekan ❌ Batal.")
+}
+
+// conversationPrompt asks for the next input of a conversation, offering to
+// cancel it.
+func conversationPrompt(c telebot.Context, text string) error {
+	menu := &telebot.ReplyMarkup{}
+	menu.Inline(menu.Row(cancelConversationBtn))
+	return c.Send(text, menu, telebot.ModeHTML)
+}
+
+// handleConversationText dispatches a text message to the flow the user is
+// in. Messages outside a conversation are treated as a drama search.
+func handleConversationText(c telebot.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conv, err := takeConversation(ctx, c.Sender().ID)
+	if err != nil {
+		log.Printf("❌ Failed to load conversation of %d: %v", c.Sender().ID, err)
+		return nil
+	}
+	if conv == nil {
+		return showSearchResults(c, cleanSearchQuery(c.Text()), 0)
+	}
+
+	handler, ok := conversationFlows[conv.Flow]
+	if !ok {
+		log.Printf("⚠️ Unknown conversation flow %q for %d", conv.Flow, c.Sender().ID)
+		return nil
+	}
+	return handler(c, conv)
+}
+
+// handleCancelConversation ends whatever the bot was waiting for:
+//
+//	/batal
+func handleCancelConversation(c telebot.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conv, err := takeConversation(ctx, c.Sender().ID)
+	if err != nil {
+		log.Printf("❌ Failed to cancel conversation of %d: %v", c.Sender().ID, err)
+	}
+
+	msg := "ℹ️ Tidak ada input yang sedang ditunggu."
+	if conv != nil {
+		msg = "✅ Dibatalkan."
+	}
+	if c.Callback() != nil {
+		_ = c.Respond()
+		return c.Edit(msg)
+	}
+	return c.Send(msg)
+}
+
+// handleReferralEnter asks for a referral code:
+//
+//	/referral
+func handleReferralEnter(c telebot.Context) error {
+	if err := startConversation(c.Sender().ID, flowReferral, "", nil); err != nil {
+		return c.Send("❌ Terjadi kesalahan. Coba beberapa saat lagi.")
+	}
+	return conversationPrompt(c, "Please send me your referral code now.")
+}
+
+func handleReferralText(c telebot.Context, conv *models.Conversation) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	code := strings.TrimSpace(c.Text())
+	n, err := database.GetUserCollection().CountDocuments(ctx, bson.M{"code": code})
+	if err != nil || n == 0 {
+		return resumeConversation(c, conv, "❌ Invalid referral code.")
+	}
+	return processReferral(c, code)
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -109,6 +110,282 @@ func GetTransactionSuccessCollection() *mongo.Collection {
 	return db.Collection("transactionSuccess")
 }
 
+func GetTransactionCollection() *mongo.Collection {
+	db := GetDatabase()
+	if db == nil {
+		log.Fatal("❌ CRITICAL: Database is nil in GetTransactionCollection")
+	}
+	return db.Collection("transactions")
+}
+
+func GetVIPGrantCollection() *mongo.Collection {
+	db := GetDatabase()
+	if db == nil {
+		log.Fatal("❌ CRITICAL: Database is nil in GetVIPGrantCollection")
+	}
+	return db.Collection("vipGrants")
+}
+
+func GetPackageCollection() *mongo.Collection {
+	db := GetDatabase()
+	if db == nil {
+		log.Fatal("❌ CRITICAL: Database is nil in GetPackageCollection")
+	}
+	return db.Collection("packages")
+}
+
+func GetVoucherCollection() *mongo.Collection {
+	db := GetDatabase()
+	if db == nil {
+		log.Fatal("❌ CRITICAL: Database is nil in GetVoucherCollection")
+	}
+	return db.Collection("vouchers")
+}
+
+func GetVoucherRedemptionCollection() *mongo.Collection {
+	db := GetDatabase()
+	if db == nil {
+		log.Fatal("❌ CRITICAL: Database is nil in GetVoucherRedemptionCollection")
+	}
+	return db.Collection("voucherRedemptions")
+}
+
+func GetVIPEventCollection() *mongo.Collection {
+	db := GetDatabase()
+	if db == nil {
+		log.Fatal("❌ CRITICAL: Database is nil in GetVIPEventCollection")
+	}
+	return db.Collection("vipEvents")
+}
+
+func GetReferralLedgerCollection() *mongo.Collection {
+	db := GetDatabase()
+	if db == nil {
+		log.Fatal("❌ CRITICAL: Database is nil in GetReferralLedgerCollection")
+	}
+	return db.Collection("referralLedger")
+}
+
+func GetPayoutCollection() *mongo.Collection {
+	db := GetDatabase()
+	if db == nil {
+		log.Fatal("❌ CRITICAL: Database is nil in GetPayoutCollection")
+	}
+	return db.Collection("payouts")
+}
+
+func GetConversationCollection() *mongo.Collection {
+	db := GetDatabase()
+	if db == nil {
+		log.Fatal("❌ CRITICAL: Database is nil in GetConversationCollection")
+	}
+	return db.Collection("conversations")
+}
+
+func GetWatchHistoryCollection() *mongo.Collection {
+	db := GetDatabase()
+	if db == nil {
+		log.Fatal("❌ CRITICAL: Database is nil in GetWatchHistoryCollection")
+	}
+	return db.Collection("watchHistory")
+}
+
+func GetFavoriteCollection() *mongo.Collection {
+	db := GetDatabase()
+	if db == nil {
+		log.Fatal("❌ CRITICAL: Database is nil in GetFavoriteCollection")
+	}
+	return db.Collection("favorites")
+}
+
+// EnsureIndexes creates the indexes the bot relies on. It is safe to call on
+// every start; existing indexes are left untouched.
+func EnsureIndexes(ctx context.Context) error {
+	_, err := GetTransactionCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "transactionID", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "telegramID", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "state", Value: 1}},
+		},
+		{
+			Keys:    bson.D{{Key: "voucher_code", Value: 1}, {Key: "telegramID", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+		{
+			Keys:    bson.D{{Key: "recipientID", Value: 1}, {Key: "created_at", Value: -1}},
+			Options: options.Index().SetSparse(true),
+		},
+		{
+			Keys:    bson.D{{Key: "referral_code", Value: 1}, {Key: "state", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+		{
+			Keys:    bson.D{{Key: "payer_name", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+		{
+			Keys:    bson.D{{Key: "referral_hold.status", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = GetVIPGrantCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "telegramID", Value: 1}, {Key: "created_at", Value: -1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = GetPackageCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "code", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = GetVoucherCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "code", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = GetVoucherRedemptionCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "code", Value: 1}, {Key: "telegramID", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = GetUserCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "is_vip", Value: 1}, {Key: "expire_time", Value: 1}},
+		},
+		{
+			Keys:    bson.D{{Key: "expire_sweep", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+		{
+			Keys:    bson.D{{Key: "referral_code", Value: 1}, {Key: "created_at", Value: -1}},
+			Options: options.Index().SetSparse(true),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = GetVIPEventCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "telegramID", Value: 1}, {Key: "created_at", Value: -1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = GetReferralLedgerCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "telegramID", Value: 1}, {Key: "created_at", Value: -1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = GetPayoutCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "payoutID", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: 1}},
+		},
+		{
+			// Satu pengajuan yang menunggu per user
+			Keys:    bson.D{{Key: "telegramID", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"status": "pending"}),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = GetDramaCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "title", Value: 1}},
+		},
+		{
+			// Tanpa bahasa: MongoDB tidak punya stemmer Bahasa Indonesia,
+			// jadi kata dicocokkan apa adanya (tetap abaikan huruf besar
+			// dan aksen).
+			Keys: bson.D{
+				{Key: "title", Value: "text"},
+				{Key: "key_word", Value: "text"},
+				{Key: "cast", Value: "text"},
+				{Key: "tag", Value: "text"},
+			},
+			Options: options.Index().
+				SetName("drama_text").
+				SetDefaultLanguage("none").
+				SetWeights(bson.D{
+					{Key: "title", Value: 10},
+					{Key: "key_word", Value: 5},
+					{Key: "tag", Value: 3},
+					{Key: "cast", Value: 2},
+				}),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = GetConversationCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "telegramID", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = GetWatchHistoryCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "telegramID", Value: 1}, {Key: "drama_slug", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "telegramID", Value: 1}, {Key: "updated_at", Value: -1}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = GetFavoriteCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "telegramID", Value: 1}, {Key: "drama_slug", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			// Untuk mengabari semua penyimpan saat part baru ditambahkan
+			Keys: bson.D{{Key: "drama_slug", Value: 1}},
+		},
+	})
+	return err
+}
+
 func HealthCheck(ctx context.Context) error {
 	if client == nil {
 		return mongo.ErrClientDisconnected
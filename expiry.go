@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/telebot.v3"
+
+	"transferin-drama/database"
+	"transferin-drama/models"
+)
+
+// expiredNoticeWindow is how long after expiry the final message is still
+// worth sending.
+const expiredNoticeWindow = 48 * time.Hour
+
+// startExpirySweeper downgrades lapsed VIPs in bulk, so is_vip can be trusted
+// without checking expire_time on every request.
+func startExpirySweeper(ctx context.Context, n *notifier, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	log.Printf("✅ VIP expiry sweeper started (every %s)", interval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("🛑 VIP expiry sweeper stopped")
+			return
+		case <-ticker.C:
+			sweepExpiredVIP(ctx, n)
+		}
+	}
+}
+
+// renewedSince reports whether a user swept as expired has VIP again.
+func renewedSince(ctx context.Context, userID int64) bool {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	n, err := database.GetUserCollection().CountDocuments(ctx, bson.M{
+		"telegram_user_id": userID,
+		"is_vip":           true,
+		"expire_time":      bson.M{"$gt": GetJakartaTime()},
+	})
+	return err == nil && n > 0
+}
+
+func sweepExpiredVIP(ctx context.Context, n *notifier) {
+	col := database.GetUserCollection()
+	now := GetJakartaTime()
+
+	// Each run tags the users it expires, so exactly those get an event.
+	// Someone who renews between the tagging and the listing has VIP and an
+	// expire_time again, and is left out of the listing below.
+	sweepID := strconv.FormatInt(now.UnixNano(), 36)
+
+	updateCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	res, err := col.UpdateMany(updateCtx,
+		bson.M{"expire_time": bson.M{"$lte": now}},
+		mongo.Pipeline{
+			{{Key: "$set", Value: bson.D{
+				{Key: "lapsed_at", Value: "$expire_time"},
+				{Key: "expire_sweep", Value: sweepID},
+				{Key: "is_vip", Value: false},
+				{Key: "expire_time", Value: nil},
+			}}},
+		},
+	)
+	cancel()
+	if err != nil {
+		log.Printf("❌ Failed to expire lapsed VIPs: %v", err)
+		return
+	}
+	if res.ModifiedCount == 0 {
+		return
+	}
+
+	findCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	cursor, err := col.Find(findCtx, bson.M{"expire_sweep": sweepID, "is_vip": false, "expire_time": nil},
+		options.Find().SetProjection(bson.M{"telegram_user_id": 1, "lapsed_at": 1, "reminder_opt_out": 1}))
+	var swept []models.User
+	if err == nil {
+		err = cursor.All(findCtx, &swept)
+	}
+	if err != nil {
+		log.Printf("❌ Failed to list expired VIPs of sweep %s: %v", sweepID, err)
+		return
+	}
+
+	events := make([]interface{}, 0, len(swept))
+	for _, u := range swept {
+		invalidateCachedUser(u.TelegramUserID)
+		events = append(events, models.VIPEvent{
+			TelegramID: u.TelegramUserID,
+			Type:       models.VIPEventExpired,
+			ExpireTime: *u.LapsedAt,
+			CreatedAt:  now,
+		})
+	}
+	if len(events) > 0 {
+		if _, err := database.GetVIPEventCollection().InsertMany(findCtx, events); err != nil {
+			log.Printf("⚠️ Failed to record %d VIP expiry events: %v", len(events), err)
+		}
+	}
+	if _, err := col.UpdateMany(findCtx, bson.M{"expire_sweep": sweepID}, bson.M{"$unset": bson.M{"expire_sweep": ""}}); err != nil {
+		log.Printf("⚠️ Failed to clear sweep %s: %v", sweepID, err)
+	}
+	log.Printf("⌛ Expired %d lapsed VIP users", len(swept))
+
+	for _, u := range swept {
+		// VIP lama yang belum pernah direset tidak perlu dikabari lagi
+		if u.ReminderOptOut || u.LapsedAt.Before(now.Add(-expiredNoticeWindow)) {
+			continue
+		}
+		// Antrean notifier bisa lama; jangan kabari yang sudah perpanjang
+		if renewedSince(ctx, u.TelegramUserID) {
+			continue
+		}
+		msg := fmt.Sprintf("😢 <b>VIP kamu sudah berakhir.</b>\n\n"+
+			"Sekarang akses kamu kembali dibatasi %d part per hari.\n"+
+			"Perpanjang VIP untuk lanjut nonton tanpa batas! 💎", freeDailyQuota())
+		if !n.send(ctx, u.TelegramUserID, msg, renewalMenu(ctx, u.TelegramUserID), telebot.ModeHTML) && ctx.Err() != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/telebot.v3"
+
+	"transferin-drama/database"
+	"transferin-drama/models"
+)
+
+const favoritesLimit = 20
+
+// favoriteBtn is the "❤️ Simpan" button under a video; its data is the
+// drama slug.
+func favoriteBtn(menu *telebot.ReplyMarkup, dramaSlug string) telebot.Btn {
+	return menu.Data("❤️ Simpan", "fav_save", dramaSlug)
+}
+
+// handleFavoriteSave saves the drama of the video the button is under.
+// Saving twice is harmless.
+func handleFavoriteSave(c telebot.Context) error {
+	slug := c.Data()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := database.GetFavoriteCollection().UpdateOne(ctx,
+		bson.M{"telegramID": c.Sender().ID, "drama_slug": slug},
+		bson.M{"$setOnInsert": bson.M{"created_at": GetJakartaTime()}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		log.Printf("❌ Failed to save favorite %s for %d: %v", slug, c.Sender().ID, err)
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ Gagal menyimpan. Coba lagi nanti."})
+	}
+	return c.Respond(&telebot.CallbackResponse{Text: "❤️ Disimpan! Lihat di /favorit. Kamu akan dikabari saat ada part baru."})
+}
+
+// handleFavorites lists the user's saved dramas:
+//
+//	/favorit
+func handleFavorites(c telebot.Context) error {
+	if c.Callback() != nil {
+		_ = c.Respond()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := database.GetFavoriteCollection().Find(ctx,
+		bson.M{"telegramID": c.Sender().ID},
+		options.Find().
+			SetSort(bson.D{{Key: "created_at", Value: -1}}).
+			SetLimit(favoritesLimit),
+	)
+	var favorites []models.Favorite
+	if err == nil {
+		err = cursor.All(ctx, &favorites)
+	}
+	var dramas []models.Drama
+	if err == nil && len(favorites) > 0 {
+		slugs := make([]string, 0, len(favorites))
+		for _, f := range favorites {
+			slugs = append(slugs, f.DramaSlug)
+		}
+		cursor, err = database.GetDramaCollection().Find(ctx,
+			bson.M{"slug": bson.M{"$in": slugs}},
+			options.Find().
+				SetProjection(bson.M{"title": 1, "slug": 1, "total_part": 1}).
+				SetSort(bson.D{{Key: "title", Value: 1}}),
+		)
+		if err == nil {
+			err = cursor.All(ctx, &dramas)
+		}
+	}
+	if err != nil {
+		log.Println("❌ Gagal memuat favorit:", err)
+		return c.Send("❌ Gagal memuat favorit. Coba beberapa saat lagi.")
+	}
+
+	menu := &telebot.ReplyMarkup{}
+	var rows []telebot.Row
+	for _, d := range dramas {
+		rows = append(rows, menu.Row(
+			menu.Data(fmt.Sprintf("📋 %s (%d part)", d.Title, d.TotalPart), "drama", d.ID.Hex()),
+			menu.Data("🗑", "fav_remove", d.ID.Hex()),
+		))
+	}
+	rows = append(rows, menu.Row(menu.Data("🎬 Katalog", "catalog", catalogQuery{Sort: catalogNewest}.data())))
+	menu.Inline(rows...)
+
+	msg := "❤️ <b>Drama Favorit</b>\n\nKamu akan dikabari saat drama di sini dapat part baru. Tekan 🗑 untuk menghapus."
+	if len(dramas) == 0 {
+		msg = "❤️ Belum ada drama favorit.\n\nTekan <b>❤️ Simpan</b> di bawah video untuk menyimpan drama ke sini."
+	}
+
+	if c.Callback() != nil {
+		return c.Edit(msg, menu, telebot.ModeHTML)
+	}
+	return c.Send(msg, menu, telebot.ModeHTML)
+}
+
+// handleFavoriteRemove removes a drama from the list and shows it again.
+func handleFavoriteRemove(c telebot.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	d, err := getDramaByID(ctx, c.Data())
+	if err != nil {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ Drama tidak ditemukan."})
+	}
+	if _, err := database.GetFavoriteCollection().DeleteOne(ctx, bson.M{
+		"telegramID": c.Sender().ID,
+		"drama_slug": d.Slug,
+	}); err != nil {
+		log.Printf("❌ Failed to remove favorite %s for %d: %v", d.Slug, c.Sender().ID, err)
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ Gagal menghapus. Coba lagi nanti."})
+	}
+	return handleFavorites(c)
+}
+
+// notifyNewParts tells everyone who saved d that parts from..to were added.
+// It runs through the shared notifier, so a popular drama cannot flood
+// Telegram or hold up the other jobs for long.
+func notifyNewParts(ctx context.Context, n *notifier, d models.Drama, from, to int) {
+	cursor, err := database.GetFavoriteCollection().Find(ctx,
+		bson.M{"drama_slug": d.Slug},
+		options.Find().SetProjection(bson.M{"telegramID": 1}),
+	)
+	if err != nil {
+		log.Printf("❌ Failed to load subscribers of %s: %v", d.Slug, err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	parts := fmt.Sprintf("Part %d", from)
+	if to > from {
+		parts = fmt.Sprintf("Part %d–%d", from, to)
+	}
+	msg := fmt.Sprintf(
+		"🔔 <b>Part baru!</b>\n\n🎬 <b>%s</b> yang kamu simpan sekarang punya %s.",
+		html.EscapeString(d.Title), parts,
+	)
+	menu := &telebot.ReplyMarkup{}
+	menu.Inline(menu.Row(
+		menu.Data(fmt.Sprintf("▶️ Tonton Part %d", from), "drama_part", fmt.Sprintf("%s|%d", d.ID.Hex(), from)),
+		menu.Data("📋 Semua Part", "drama", d.ID.Hex()),
+	))
+
+	sent := 0
+	for cursor.Next(ctx) {
+		var f models.Favorite
+		if err := cursor.Decode(&f); err != nil {
+			continue
+		}
+		if n.send(ctx, f.TelegramID, msg, menu, telebot.ModeHTML) {
+			sent++
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		log.Printf("⚠️ Subscribers of %s: %v", d.Slug, err)
+	}
+	log.Printf("🔔 Notified %d subscribers of %s about parts %d-%d", sent, d.Slug, from, to)
+}
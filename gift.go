@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"gopkg.in/telebot.v3"
+
+	"transferin-drama/database"
+	"transferin-drama/models"
+)
+
+var (
+	errGiftHiddenSender = errors.New("forwarded sender is hidden")
+	errGiftUnknownUser  = errors.New("gift recipient has not started the bot")
+	errGiftSelf         = errors.New("gift recipient is the buyer")
+)
+
+func giftRecipientErrorText(err error) string {
+	switch {
+	case errors.Is(err, errGiftHiddenSender):
+		return "🔒 Akun teman kamu menyembunyikan identitas saat pesannya diteruskan.\nKirim @username atau user ID-nya saja."
+	case errors.Is(err, errGiftUnknownUser):
+		return "❌ Penerima belum pernah memulai bot ini. Minta teman kamu ketik /start dulu."
+	case errors.Is(err, errGiftSelf):
+		return "⚠️ Itu akun kamu sendiri. Pilih tombol Bayar untuk membeli VIP untuk diri sendiri."
+	}
+	return "❌ Gagal mencari penerima. Coba lagi nanti."
+}
+
+// giftRecipientFromMessage resolves the recipient from a forwarded message,
+// an @username or a numeric user ID.
+func giftRecipientFromMessage(c telebot.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var query string
+	msg := c.Message()
+	switch {
+	case msg.OriginalSender != nil:
+		query = strconv.FormatInt(msg.OriginalSender.ID, 10)
+	case msg.OriginalSenderName != "":
+		return 0, errGiftHiddenSender
+	default:
+		query = strings.TrimSpace(c.Text())
+	}
+
+	recipient, err := findGiftRecipient(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	if recipient.TelegramUserID == c.Sender().ID {
+		return 0, errGiftSelf
+	}
+	return recipient.TelegramUserID, nil
+}
+
+// findGiftRecipient looks up a registered user by @username or user ID.
+func findGiftRecipient(ctx context.Context, query string) (*models.User, error) {
+	filter := bson.M{"telegram_username": strings.TrimPrefix(query, "@")}
+	if id, err := strconv.ParseInt(query, 10, 64); err == nil {
+		filter = bson.M{"telegram_user_id": id}
+	}
+
+	var u models.User
+	err := database.GetUserCollection().FindOne(ctx, filter).Decode(&u)
+	if err == mongo.ErrNoDocuments {
+		return nil, errGiftUnknownUser
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// orderRecipient returns the gift recipient of a checkout order, or nil
+// when the buyer is buying for themselves.
+func orderRecipient(ctx context.Context, order checkoutOrder, buyerID int64) (*models.User, error) {
+	if order.Recipient == 0 {
+		return nil, nil
+	}
+	recipient, err := findGiftRecipient(ctx, strconv.FormatInt(order.Recipient, 10))
+	if err != nil {
+		return nil, err
+	}
+	if recipient.TelegramUserID == buyerID {
+		return nil, errGiftSelf
+	}
+	return recipient, nil
+}
+
+func giftRecipientName(u *models.User) string {
+	if u.TelegramUsername != "" {
+		return "@" + u.TelegramUsername
+	}
+	return u.TelegramName
+}
+
+func sendGiftNotification(bot *telebot.Bot, payer *models.User, recipient *models.User, duration int) {
+	msg := fmt.Sprintf(
+		"🎁 <b>Kamu dapat hadiah VIP!</b>\n\n"+
+			"👤 Dari: <b>%s</b>\n"+
+			"📦 <b>Paket:</b> Akses VIP %d Hari\n"+
+			"⏳ Aktif sampai: %s WIB\n\n"+
+			"📺 Selamat nonton semua drama tanpa batas!",
+		html.EscapeString(payer.TelegramName), duration, recipient.ExpireTime.Format("02-01-2006 15:04"),
+	)
+	bot.Send(&telebot.User{ID: recipient.TelegramUserID}, msg, telebot.ModeHTML)
+
+	msg = fmt.Sprintf(
+		"✅ <b>Hadiah VIP terkirim!</b>\n\n"+
+			"🎁 <b>%s</b> sekarang punya akses VIP %d Hari.\n"+
+			"Terima kasih sudah berbagi! 💖",
+		html.EscapeString(giftRecipientName(recipient)), duration,
+	)
+	bot.Send(&telebot.User{ID: payer.TelegramUserID}, msg, telebot.ModeHTML)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"gopkg.in/telebot.v3"
+
+	"transferin-drama/database"
+	"transferin-drama/models"
+)
+
+const (
+	historyPageSize  = 5
+	historyMaxLoaded = 100
+)
+
+var transactionStateLabels = map[models.TransactionState]string{
+	models.StateCreated:         "📝 Dibuat",
+	models.StateAwaitingPayment: "⏳ Menunggu pembayaran",
+	models.StatePaid:            "💳 Dibayar",
+	models.StateActivated:       "✅ Aktif",
+	models.StateCancelled:       "❌ Dibatalkan",
+	models.StateExpired:         "⌛ Kedaluwarsa",
+	models.StateRefunded:        "↩️ Direfund",
+}
+
+// formatAmount renders a ledger amount in its currency.
+func formatAmount(currency string, amount int) string {
+	if currency == models.CurrencyStars {
+		return fmt.Sprintf("%d ⭐", amount)
+	}
+	return message.NewPrinter(language.Indonesian).Sprintf("Rp %d", amount)
+}
+
+type historyEntry struct {
+	At   time.Time
+	Text string
+}
+
+// recordGrant stores a VIP grant for /history. Inside a session an error
+// aborts the grant, so no VIP is given without its history row.
+func recordGrant(ctx context.Context, grant models.VIPGrant) error {
+	if grant.CreatedAt.IsZero() {
+		grant.CreatedAt = GetJakartaTime()
+	}
+	if _, err := database.GetVIPGrantCollection().InsertOne(ctx, grant); err != nil {
+		log.Printf("❌ Failed to record %s grant for %d: %v", grant.Type, grant.TelegramID, err)
+		return err
+	}
+	return nil
+}
+
+// handleHistory lists the sender's purchases and VIP grants, newest first.
+func handleHistory(c telebot.Context) error {
+	page := 0
+	if c.Callback() != nil && c.Callback().Unique == "history_page" {
+		page, _ = strconv.Atoi(c.Data())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	entries, err := loadHistory(ctx, c.Sender().ID)
+	if err != nil {
+		log.Println("❌ Gagal mengambil riwayat transaksi:", err)
+		return c.Send("Terjadi kesalahan saat memuat riwayat kamu. Coba beberapa saat lagi.")
+	}
+
+	reply := &telebot.ReplyMarkup{}
+
+	if len(entries) == 0 {
+		reply.Inline(reply.Row(statusBtn), reply.Row(backBtn))
+		msg := "🧾 <b>Riwayat Transaksi</b>\n\nBelum ada transaksi. Ketik /vip untuk berlangganan."
+		if c.Callback() != nil {
+			return c.Edit(msg, reply, telebot.ModeHTML)
+		}
+		return c.Send(msg, reply, telebot.ModeHTML)
+	}
+
+	totalPages := (len(entries) + historyPageSize - 1) / historyPageSize
+	if page < 0 || page >= totalPages {
+		page = 0
+	}
+
+	var msg strings.Builder
+	msg.WriteString(fmt.Sprintf("🧾 <b>Riwayat Transaksi</b> (hal. %d/%d)\n\n", page+1, totalPages))
+
+	end := (page + 1) * historyPageSize
+	if end > len(entries) {
+		end = len(entries)
+	}
+	for _, e := range entries[page*historyPageSize : end] {
+		msg.WriteString(e.Text)
+		msg.WriteString("\n\n")
+	}
+	msg.WriteString("📩 Ada kendala pembayaran? Chat admin: @domi_nuc")
+
+	var nav []telebot.Btn
+	if page > 0 {
+		nav = append(nav, reply.Data("⬅️ Sebelumnya", "history_page", strconv.Itoa(page-1)))
+	}
+	if page < totalPages-1 {
+		nav = append(nav, reply.Data("Berikutnya ➡️", "history_page", strconv.Itoa(page+1)))
+	}
+	rows := []telebot.Row{}
+	if len(nav) > 0 {
+		rows = append(rows, reply.Row(nav...))
+	}
+	rows = append(rows, reply.Row(statusBtn), reply.Row(backBtn))
+	reply.Inline(rows...)
+
+	if c.Callback() != nil {
+		return c.Edit(msg.String(), reply, telebot.ModeHTML)
+	}
+	return c.Send(msg.String(), reply, telebot.ModeHTML)
+}
+
+func loadHistory(ctx context.Context, telegramID int64) ([]historyEntry, error) {
+	findOpts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(historyMaxLoaded)
+
+	var entries []historyEntry
+
+	cursor, err := database.GetTransactionCollection().Find(ctx, bson.M{
+		"$or": bson.A{bson.M{"telegramID": telegramID}, bson.M{"recipientID": telegramID}},
+	}, findOpts)
+	if err != nil {
+		return nil, err
+	}
+	var txs []models.Transaction
+	if err := cursor.All(ctx, &txs); err != nil {
+		return nil, err
+	}
+	for _, tx := range txs {
+		var b strings.Builder
+		b.WriteString(fmt.Sprintf("🧾 <code>%s</code>\n", tx.TransactionID))
+		b.WriteString(fmt.Sprintf("📦 Paket: %s (%d hari)\n", tx.PackageCode, tx.Duration))
+		switch {
+		case tx.RecipientID == telegramID:
+			b.WriteString(fmt.Sprintf("🎁 Hadiah dari user <code>%d</code>\n", tx.TelegramID))
+		case tx.RecipientID != 0:
+			b.WriteString(fmt.Sprintf("🎁 Hadiah untuk user <code>%d</code>\n", tx.RecipientID))
+		}
+		b.WriteString(fmt.Sprintf("💲 Nominal: %s\n", formatAmount(tx.Currency, tx.Amount)))
+		if tx.VoucherCode != "" {
+			b.WriteString(fmt.Sprintf("🎟️ Voucher: %s\n", tx.VoucherCode))
+		}
+		b.WriteString(fmt.Sprintf("📌 Status: %s", transactionStateLabels[tx.State]))
+		if tx.ActivatedAt != nil {
+			b.WriteString(fmt.Sprintf("\n⏱ Aktif: %s WIB", tx.ActivatedAt.Format("02-01-2006 15:04")))
+		}
+		if tx.BonusDays > 0 {
+			b.WriteString(fmt.Sprintf("\n🎁 Bonus referral: %d hari", tx.BonusDays))
+		}
+		entries = append(entries, historyEntry{At: tx.CreatedAt, Text: b.String()})
+	}
+
+	// Pembelian sebelum ledger transaksi dipakai
+	cursor, err = database.GetTransactionSuccessCollection().Find(ctx, bson.M{"telegramID": telegramID},
+		options.Find().SetSort(bson.D{{Key: "activatedAt", Value: -1}}).SetLimit(historyMaxLoaded))
+	if err != nil {
+		return nil, err
+	}
+	var legacy []models.TransactionSuccess
+	if err := cursor.All(ctx, &legacy); err != nil {
+		return nil, err
+	}
+	for _, tx := range legacy {
+		entries = append(entries, historyEntry{
+			At: tx.ActivatedAt,
+			Text: fmt.Sprintf("🧾 <code>%s</code>\n📦 Paket: %d hari\n📌 Status: %s\n⏱ Aktif: %s WIB",
+				tx.TransactionID, tx.Duration, transactionStateLabels[models.StateActivated], tx.ActivatedAt.Format("02-01-2006 15:04")),
+		})
+	}
+
+	cursor, err = database.GetVIPGrantCollection().Find(ctx, bson.M{"telegramID": telegramID}, findOpts)
+	if err != nil {
+		return nil, err
+	}
+	var grants []models.VIPGrant
+	if err := cursor.All(ctx, &grants); err != nil {
+		return nil, err
+	}
+	for _, g := range grants {
+		var text string
+		switch g.Type {
+		case models.GrantReferral:
+			text = fmt.Sprintf("🎁 <b>Bonus Referral</b> +%d hari\n👤 Dari pembelian: %s", g.Days, html.EscapeString(maskName(g.Note)))
+		case models.GrantRevoked:
+			label := "Bonus Referral Ditarik"
+			if g.Note == models.GrantNotePurchase {
+				label = "VIP Ditarik"
+			}
+			text = fmt.Sprintf("↩️ <b>%s</b> %d hari\n🧾 Refund: <code>%s</code>", label, g.Days, g.TransactionID)
+		default:
+			text = fmt.Sprintf("👑 <b>Penyesuaian Admin</b> %+d hari", g.Days)
+		}
+		text += fmt.Sprintf("\n⏱ %s WIB", g.CreatedAt.Format("02-01-2006 15:04"))
+		entries = append(entries, historyEntry{At: g.CreatedAt, Text: text})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].At.After(entries[j].At)
+	})
+	return entries, nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"gopkg.in/telebot.v3"
+
+	"transferin-drama/models"
+)
+
+const (
+	// inlinePageSize is how many dramas one inline answer holds; Telegram
+	// accepts at most 50.
+	inlinePageSize = 20
+	// inlineCacheTime is how long Telegram and memcache keep an inline
+	// answer. New dramas show up in inline search after at most this long.
+	inlineCacheTime = 300
+)
+
+// inlinePage is what is cached for one page of an inline query.
+type inlinePage struct {
+	Dramas []models.Drama `json:"dramas"`
+	Total  int64          `json:"total"`
+}
+
+// inlineCacheKey keeps memcache keys short and free of spaces whatever the
+// user typed.
+func inlineCacheKey(query string, page int) string {
+	sum := sha1.Sum([]byte(strings.ToLower(query)))
+	return fmt.Sprintf("inline:%s:%d", hex.EncodeToString(sum[:]), page)
+}
+
+func getCachedInlinePage(query string, page int) (*inlinePage, error) {
+	item, err := mc.Get(inlineCacheKey(query, page))
+	if err != nil {
+		return nil, err
+	}
+
+	var p inlinePage
+	err = json.Unmarshal(item.Value, &p)
+	return &p, err
+}
+
+func setCachedInlinePage(query string, page int, p inlinePage) {
+	data, _ := json.Marshal(p)
+	_ = mc.Set(&memcache.Item{
+		Key:        inlineCacheKey(query, page),
+		Value:      data,
+		Expiration: inlineCacheTime,
+	})
+}
+
+// inlineResult is the article shared into a chat for d, with a button that
+// opens part 1 in the bot.
+func inlineResult(d models.Drama) *telebot.ArticleResult {
+	watchURL := fmt.Sprintf("https://t.me/dramatrans_bot?start=%s_part_1", d.Slug)
+
+	menu := &telebot.ReplyMarkup{}
+	menu.Inline(menu.Row(menu.URL("▶️ Tonton", watchURL)))
+
+	desc := fmt.Sprintf("%d part", d.TotalPart)
+	if d.Cast != "" {
+		desc += " • " + d.Cast
+	}
+
+	text := fmt.Sprintf("🎬 <b>%s</b>\n📺 %d part", html.EscapeString(d.Title), d.TotalPart)
+	if d.Tag != "" {
+		text += "\n🏷️ " + html.EscapeString(d.Tag)
+	}
+	text += "\n\nNonton gratis di @dramatrans_bot 👇"
+
+	result := &telebot.ArticleResult{
+		Title:       d.Title,
+		Description: desc,
+		Text:        text,
+		ThumbURL:    d.Cover,
+	}
+	result.ID = d.ID.Hex()
+	result.ParseMode = telebot.ModeHTML
+	result.ReplyMarkup = menu
+	return result
+}
+
+// handleInlineQuery answers "@dramatrans_bot <judul>" from any chat with the
+// matching dramas, using the same search as /search. Inline mode has to be
+// enabled for the bot in BotFather (/setinline).
+func handleInlineQuery(c telebot.Context) error {
+	q := c.Query()
+	query := cleanSearchQuery(q.Text)
+	if query == "" {
+		return c.Answer(&telebot.QueryResponse{
+			CacheTime:    inlineCacheTime,
+			SwitchPMText: "🎬 Buka katalog drama",
+			// Tercatat sebagai start_source user baru
+			SwitchPMParameter: "src_inline",
+		})
+	}
+	page, _ := strconv.Atoi(q.Offset)
+
+	cached, err := getCachedInlinePage(query, page)
+	if err != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		dramas, total, err := searchDramas(ctx, query, page, inlinePageSize)
+		if err != nil {
+			log.Println("❌ Gagal mencari drama (inline):", err)
+			return c.Answer(&telebot.QueryResponse{})
+		}
+		cached = &inlinePage{Dramas: dramas, Total: total}
+		setCachedInlinePage(query, page, *cached)
+	}
+
+	results := make(telebot.Results, 0, len(cached.Dramas))
+	for _, d := range cached.Dramas {
+		results = append(results, inlineResult(d))
+	}
+
+	resp := &telebot.QueryResponse{
+		Results:   results,
+		CacheTime: inlineCacheTime,
+	}
+	if int64((page+1)*inlinePageSize) < cached.Total {
+		resp.NextOffset = strconv.Itoa(page + 1)
+	}
+	if len(results) == 0 && page == 0 {
+		resp.SwitchPMText = "🔍 Tidak ketemu? Cari di bot"
+		resp.SwitchPMParameter = "src_inline"
+	}
+	return c.Answer(resp)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"transferin-drama/database"
+	"transferin-drama/models"
+)
+
+var errInvalidTransition = errors.New("invalid transaction state transition")
+
+// createTransaction inserts a new purchase into the ledger in the created state.
+func createTransaction(ctx context.Context, tx *models.Transaction) error {
+	now := GetJakartaTime()
+	tx.State = models.StateCreated
+	tx.History = []models.StateChange{{State: models.StateCreated, At: now}}
+	tx.CreatedAt = now
+	tx.UpdatedAt = now
+
+	_, err := database.GetTransactionCollection().InsertOne(ctx, tx)
+	return err
+}
+
+func getTransaction(ctx context.Context, transactionID string) (*models.Transaction, error) {
+	var tx models.Transaction
+	err := database.GetTransactionCollection().FindOne(ctx, bson.M{"transactionID": transactionID}).Decode(&tx)
+	if err != nil {
+		return nil, err
+	}
+	return &tx, nil
+}
+
+// transitionTransaction moves a transaction to the next state and appends a
+// timestamped history entry. The current state is part of the filter, so two
+// concurrent transitions can never both succeed. Extra fields in set are
+// written in the same update.
+func transitionTransaction(ctx context.Context, transactionID string, to models.TransactionState, note string, set bson.M) (*models.Transaction, error) {
+	now := GetJakartaTime()
+
+	fields := bson.M{"state": to, "updated_at": now}
+	for k, v := range set {
+		fields[k] = v
+	}
+
+	var tx models.Transaction
+	err := database.GetTransactionCollection().FindOneAndUpdate(ctx,
+		bson.M{
+			"transactionID": transactionID,
+			"state":         bson.M{"$in": models.StatesBefore(to)},
+		},
+		bson.M{
+			"$set":  fields,
+			"$push": bson.M{"history": models.StateChange{State: to, At: now, Note: note}},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&tx)
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("%w: %s -> %s", errInvalidTransition, transactionID, to)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tx, nil
+}
@@ -1,11 +1,12 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html"
 	"log"
 	"math/rand"
 	"net/http"
@@ -26,6 +27,7 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/skip2/go-qrcode"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
@@ -41,6 +43,7 @@ import (
 	"transferin-drama/database" // Import your database package
 	"transferin-drama/middleware"
 	"transferin-drama/models"
+	"transferin-drama/payment"
 )
 
 var (
@@ -48,6 +51,9 @@ var (
 	db  *mongo.Database
 )
 
+// paymentProvider creates QRIS invoices and confirms webhook notifications.
+var paymentProvider payment.PaymentProvider
+
 var (
 	lastVideoMessagesMu sync.RWMutex
 	lastVideoMessages   = make(map[int64]*telebot.Message)
@@ -59,46 +65,17 @@ var (
 
 var mc = memcache.New("127.0.0.1:11211")
 
-var qrLink = map[string]int{
-	"vip_1d":  2000,
-	"vip_3d":  4000,
-	"vip_7d":  9000,
-	"vip_30d": 25000,
-}
-
-var packageDuration = map[string]int{
-	"vip_1d":  1,
-	"vip_3d":  3,
-	"vip_7d":  7,
-	"vip_30d": 30,
-}
-
 var menu = &telebot.ReplyMarkup{}
 var startBtn = menu.Data("🎬 Mulai Nonton", "start_watch")
 var vipBtn = menu.Data("💎 Langganan VIP 🔐", "vip")
 var statusBtn = menu.Data("ℹ️ Cek Status Akun", "cek_status")
 var backBtn = menu.Data("🔙 Kembali", "back_to_start")
+var historyBtn = menu.Data("🧾 Riwayat Transaksi", "history")
 var cancelBtn telebot.Btn
 var nextBtn telebot.Btn
 var prevBtn telebot.Btn
 var parentDir = `home/melolo`
 
-type Package struct {
-	Days   int
-	Amount int
-}
-
-type APIResponse struct {
-	Payment struct {
-		PaymentNumber string `json:"payment_number"`
-		ExpiredAt     string `json:"expired_at"`
-	} `json:"payment"`
-}
-
-type CancelResponse struct {
-	Success bool `json:"success"`
-}
-
 const (
 	spreadsheetID = "1IRnsdu7xEWL3kPApxHBwlew8uf2YmjPc1lcZk6U58ng"
 	sheetName     = "sheet1"
@@ -145,6 +122,12 @@ func setCachedVideo(video models.Video) {
 	log.Print("cached saved")
 }
 
+func invalidateCachedVideo(slug string) {
+	if err := mc.Delete("fileid:" + slug); err != nil && err != memcache.ErrCacheMiss {
+		log.Printf("⚠️ Failed to invalidate cached video %s: %v", slug, err)
+	}
+}
+
 func getCachedDrama(slug string) (*models.Drama, error) {
 	key := "drama:" + slug
 
@@ -189,35 +172,18 @@ func setCachedUser(user models.User) {
 	})
 }
 
+func invalidateCachedUser(uid int64) {
+	if err := mc.Delete(fmt.Sprintf("user:%d", uid)); err != nil && err != memcache.ErrCacheMiss {
+		log.Printf("⚠️ Failed to invalidate cached user %d: %v", uid, err)
+	}
+}
+
 func GetJakartaTime() time.Time {
 	// RDP (US) time is currently 15 hours 11 minutes behind Jakarta
 	offset := 0 * time.Hour
 	return time.Now().Add(offset)
 }
 
-func getPackages(amount int) (map[int]int, int) {
-	packages := []Package{
-		{30, 25000},
-		{7, 9000},
-		{3, 4000},
-		{1, 2000},
-	}
-
-	result := make(map[int]int)
-	totalDays := 0
-
-	for _, pkg := range packages {
-		count := amount / pkg.Amount
-		if count > 0 {
-			result[pkg.Days] = count
-			totalDays += count * pkg.Days
-			amount -= count * pkg.Amount
-		}
-	}
-
-	return result, totalDays
-}
-
 func generatePost(c telebot.Context, strTitle string, title string, totalParts int) error {
 	// Title is everything except last argument
 	slug := slugify(title)
@@ -228,7 +194,7 @@ func generatePost(c telebot.Context, strTitle string, title string, totalParts i
 	post.WriteString("━━━━━━━━━━━━━━━━━\n")
 
 	for i := 1; i < totalParts; i++ {
-		if i == 1 {
+		if isFreePart(i) {
 			post.WriteString(fmt.Sprintf("➠ PART %d → (Gratis Nonton) 🆓 <a href=\"https://t.me/dramatrans_bot?start=%s_part_%d\">Tonton sekarang</a>\n", i, slug, i))
 		} else {
 			post.WriteString(fmt.Sprintf("➠ PART %d → (Berlangganan VIP) 🔒 <a href=\"https://t.me/dramatrans_bot?start=%s_part_%d\">Tonton sekarang</a>\n", i, slug, i))
@@ -281,21 +247,23 @@ func handleVIP(c telebot.Context) error {
 		return c.Send("Terjadi kesalahan. Silakan coba lagi nanti.")
 	}
 
+	pkgs, err := getPackagesCatalogue(ctx, false)
+	if err != nil {
+		log.Println("❌ Gagal mengambil paket VIP:", err)
+		return c.Send("Terjadi kesalahan. Silakan coba lagi nanti.")
+	}
+
+	now := GetJakartaTime()
+
 	// Tombol pilihan paket VIP
 	vipMenu := &telebot.ReplyMarkup{}
-	vip1 := vipMenu.Data("🎟️ VIP 1 Hari – Coba Dulu 💰Rp2.000", "vip_1d")
-	vip3 := vipMenu.Data("🌟 VIP 3 Hari – Penonton Setia 💰Rp4.000", "vip_3d")
-	vip7 := vipMenu.Data("🎬 VIP 7 Hari – Pecinta Drama 💰Rp9.000", "vip_7d")
-	vip30 := vipMenu.Data("👑 VIP 30 Hari – Sultan Drama 💰Rp25.000", "vip_30d")
-	vipMenu.Inline(
-		vipMenu.Row(vip1),
-		vipMenu.Row(vip3),
-		vipMenu.Row(vip7),
-		vipMenu.Row(vip30),
-		vipMenu.Row(backBtn),
-	)
+	rows := make([]telebot.Row, 0, len(pkgs)+1)
+	for _, pkg := range pkgs {
+		rows = append(rows, vipMenu.Row(vipMenu.Data(packageButtonText(pkg, now), "buy_vip", pkg.Code)))
+	}
+	rows = append(rows, vipMenu.Row(backBtn))
+	vipMenu.Inline(rows...)
 
-	now := GetJakartaTime()
 	if u.IsVIP && u.ExpireTime != nil && u.ExpireTime.After(now) {
 		remaining := u.ExpireTime.Sub(now).Round(time.Hour)
 		hours := int(remaining.Hours())
@@ -350,7 +318,7 @@ func handleStatus(c telebot.Context) error {
 				"🆔 User ID: <code>%d</code>\n"+
 				"📛 Nama: %s\n"+
 				"👑 VIP: <b>AKTIF</b> (hingga %s WIB)\n"+
-				"🎁 Referral: <code>%s</code>\n"+
+				"🎁 Referral: <code>%s</code> • /referrals\n"+
 				"📊 Limit Harian: <i>Tidak Berlaku</i>\n\n"+
 				"🎉 Kamu adalah <b>Member VIP</b>!\nNikmati semua konten tanpa batas setiap hari. Terima kasih sudah mendukung <b>DRAMATRANS</b>! 💖",
 			u.TelegramUserID,
@@ -360,45 +328,37 @@ func handleStatus(c telebot.Context) error {
 		)
 
 		reply := &telebot.ReplyMarkup{}
-		reply.Inline(reply.Row(backBtn))
+		reply.Inline(reply.Row(historyBtn), reply.Row(backBtn))
 		if c.Callback() != nil {
 			return c.Edit(msg, reply, telebot.ModeHTML)
 		}
 		return c.Send(msg, reply, telebot.ModeHTML)
 	}
 
-	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	if u.ExpireTime != nil && u.ExpireTime.Before(now) {
-		_, err = userCollection.UpdateOne(
-			ctx,
-			bson.M{"telegram_user_id": user.ID},
-			bson.M{"$set": bson.M{"expire_time": nil, "is_vip": false}},
-		)
-		if err != nil {
-			return c.Send("❌ Ada kesalahan sistem.")
-		}
+	daily, bonus := quotaLeft(&u, now)
+	bonusLine := ""
+	if bonus > 0 {
+		bonusLine = fmt.Sprintf("🎟️ Kuota Bonus: %d\n", bonus)
 	}
-
 	msg := fmt.Sprintf(
 		"👤 <b>Status Akun Kamu</b>\n\n"+
 			"🆔 User ID: <code>%d</code>\n"+
 			"📛 Nama: %s\n"+
 			"👑 VIP: <b>Tidak Aktif</b>\n"+
-			"🎁 Referral: <code>%s</code>\n"+
-			"📊 Limit Harian: %d/10\n\n"+
-			"🚫 Kamu masih pengguna <b>Gratis</b>. Akses dibatasi maksimal <b>10 part</b> per hari.\n\n"+
+			"🎁 Referral: <code>%s</code> • /referrals\n"+
+			"📊 Kuota Hari Ini: %d/%d\n%s\n"+
+			"🚫 Kamu masih pengguna <b>Gratis</b>. Kamu bisa nonton <b>%d part pertama</b> tiap drama, maksimal <b>%d part</b> per hari (reset pukul 00.00 WIB).\n\n"+
 			"💎 Ingin akses tanpa batas ke semua konten?\n➡️ Upgrade ke VIP sekarang! Ketik /vip atau klik tombol di bawah.\n\n"+
 			"📩 Ada pertanyaan? Chat admin: @domi_nuc",
 		u.TelegramUserID,
 		u.TelegramName,
 		u.Code,
-		u.DailyLimit,
+		daily, freeDailyQuota(), bonusLine,
+		freePartsPerDrama(), freeDailyQuota(),
 	)
 
 	reply := &telebot.ReplyMarkup{}
-	reply.Inline(reply.Row(vipBtn), reply.Row(backBtn))
+	reply.Inline(reply.Row(vipBtn), reply.Row(historyBtn), reply.Row(backBtn))
 
 	if c.Callback() != nil {
 		return c.Edit(msg, reply, telebot.ModeHTML)
@@ -424,7 +384,9 @@ func generateTransactionID() string {
 	return fmt.Sprintf("INV-%s-%04d-%s", timestamp, counter%10000, randomHex)
 }
 
-func sendQris(c telebot.Context, vipCode string) error {
+// sendQris bills the package picked at checkout, applying the order's
+// voucher and gift recipient.
+func sendQris(c telebot.Context, order checkoutOrder) error {
 
 	user := c.Sender()
 	userCollection := database.GetUserCollection()
@@ -440,44 +402,87 @@ func sendQris(c telebot.Context, vipCode string) error {
 		return c.Send("Terjadi kesalahan saat memuat status akun kamu. Coba beberapa saat lagi.")
 	}
 
-	amount, ok := qrLink[vipCode]
-	if !ok {
+	vipCode, voucherCode := order.Package, order.Voucher
+
+	pkg, err := getPackage(ctx, vipCode)
+	if err != nil || !pkg.Active {
 		return c.Send("❌ Paket VIP tidak ditemukan.")
 	}
-	url := os.Getenv("PG_URL")
-	transactionID := generateTransactionID()
-	cancelBtn = menu.Data("❌ Batalkan pembayaran", "cancel_payment", fmt.Sprintf("%s|%d", transactionID, amount))
-	payload := map[string]interface{}{
-		"project":  "drama-trans",
-		"order_id": transactionID,
-		"amount":   amount,
-		"api_key":  os.Getenv("PAKASIR_API_KEY"),
-	}
-	jsonPayload, err := json.Marshal(payload)
-	if err != nil {
-		log.Fatal(err)
-	}
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonPayload))
+	price := pkg.PriceAt(GetJakartaTime())
+	amount := price
+	duration := pkg.Days
+
+	recipient, err := orderRecipient(ctx, order, user.ID)
 	if err != nil {
-		log.Fatal(err)
+		return c.Send(giftRecipientErrorText(err))
 	}
-	req.Header.Set("Content-Type", "application/json")
-	client := &http.Client{
-		Timeout: 30 * time.Second,
+
+	voucherDays := 0
+	if voucherCode != "" {
+		voucher, err := redeemVoucher(ctx, voucherCode, pkg.Code, user.ID)
+		if err != nil {
+			if !errors.Is(err, errVoucherNotFound) {
+				log.Printf("⚠️ Voucher %s rejected for user %d: %v", voucherCode, user.ID, err)
+			}
+			return c.Send(voucherErrorText(err))
+		}
+		amount, voucherDays = voucher.Apply(price, voucherMinAmount)
 	}
-	resp, err := client.Do(req)
+
+	telegramID := user.ID
+	transactionID := generateTransactionID()
+	cancelBtn = menu.Data("❌ Batalkan pembayaran", "cancel_payment", fmt.Sprintf("%s|%d", transactionID, amount))
+
+	// Catat di ledger sebelum tagihan dibuat di gateway
+	tx := &models.Transaction{
+		TransactionID: transactionID,
+		TelegramID:    telegramID,
+		Provider:      paymentProvider.Name(),
+		Currency:      models.CurrencyIDR,
+		PackageCode:   vipCode,
+		Amount:        amount,
+		Duration:      duration,
+		RecipientID:   order.Recipient,
+	}
+	if voucherCode != "" {
+		tx.VoucherCode = voucherCode
+		tx.Discount = price - amount
+		tx.VoucherDays = voucherDays
+	}
+	if err := createTransaction(ctx, tx); err != nil {
+		log.Printf("❌ Failed to create transaction %s: %v", transactionID, err)
+		releaseVoucher(ctx, tx)
+		return c.Send("❌ Gagal membuat tagihan QRIS. Silakan coba lagi nanti.")
+	}
+
+	invoice, err := paymentProvider.CreateInvoice(ctx, transactionID, amount)
 	if err != nil {
-		log.Fatal(err)
+		log.Printf("❌ Failed to create invoice via %s: %v", paymentProvider.Name(), err)
+		if cancelled, terr := transitionTransaction(ctx, transactionID, models.StateCancelled, "invoice creation failed", nil); terr != nil {
+			log.Printf("⚠️ Failed to cancel transaction %s: %v", transactionID, terr)
+		} else {
+			releaseVoucher(ctx, cancelled)
+		}
+		return c.Send("❌ Gagal membuat tagihan QRIS. Silakan coba lagi nanti.")
 	}
-	defer resp.Body.Close()
 
-	// Read the response body
-	var results APIResponse
-	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
-		log.Fatalf("Decoding failed: %v", err)
+	_, err = transitionTransaction(ctx, transactionID, models.StateAwaitingPayment, "", bson.M{"expired_at": invoice.ExpiredAt})
+	if err != nil {
+		log.Printf("❌ Failed to update transaction %s: %v", transactionID, err)
+		// QRIS sudah terbit tapi tidak akan ditampilkan
+		if cerr := paymentProvider.CancelInvoice(ctx, transactionID, amount); cerr != nil {
+			log.Printf("⚠️ Failed to cancel %s via %s: %v", transactionID, paymentProvider.Name(), cerr)
+		}
+		if cancelled, terr := transitionTransaction(ctx, transactionID, models.StateCancelled, "invoice update failed", nil); terr != nil {
+			log.Printf("⚠️ Failed to cancel transaction %s: %v", transactionID, terr)
+		} else {
+			releaseVoucher(ctx, cancelled)
+		}
+		return c.Send("❌ Gagal membuat tagihan QRIS. Silakan coba lagi nanti.")
 	}
+	log.Printf("✅ Created transaction for user %d: %s", telegramID, transactionID)
 
-	content := results.Payment.PaymentNumber
+	content := invoice.PaymentNumber
 	filename := fmt.Sprintf("qr-%d.png", user.ID)
 	err = qrcode.WriteFile(content, qrcode.Medium, 256, filename)
 
@@ -492,46 +497,6 @@ func sendQris(c telebot.Context, vipCode string) error {
 		}
 	}()
 
-	duration, ok := packageDuration[vipCode]
-	if !ok {
-		duration = 1 // fallback default: 1 bulan
-	}
-
-	telegramID := user.ID
-
-	// Masukkan ke collection transactionPending
-	pendingCol := database.GetTransactionPendingCollection()
-	now := GetJakartaTime()
-	filter := bson.M{"telegramID": telegramID}
-	update := bson.M{
-		"$set": bson.M{
-			"transactionID": transactionID, // Update transaction ID
-			"duration":      duration,
-			"updated_at":    now,
-		},
-		"$setOnInsert": bson.M{
-			"telegramID": telegramID,
-			"created_at": now,
-		},
-	}
-	opts := options.Update().SetUpsert(true)
-
-	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	updated, err := pendingCol.UpdateOne(ctx, filter, update, opts)
-
-	if err != nil {
-		return err
-	}
-
-	// Optional: Log what happened
-	if updated.UpsertedCount > 0 {
-		log.Printf("✅ Created new pending transaction for user %d: %s", telegramID, transactionID)
-	} else {
-		log.Printf("🔄 Updated pending transaction for user %d: %s", telegramID, transactionID)
-	}
-
 	p := message.NewPrinter(language.Indonesian)
 
 	// Format with the currency symbol
@@ -540,26 +505,28 @@ func sendQris(c telebot.Context, vipCode string) error {
 	// Kirim pesan ke user
 
 	var msg strings.Builder
-	fmt.Println(results)
-	if results.Payment.ExpiredAt == "" {
-		fmt.Println("Error: expired_at is still empty. Check JSON key names.")
-		return nil
-	}
-	t, err := time.Parse(time.RFC3339Nano, results.Payment.ExpiredAt)
-	if err != nil {
-		fmt.Println("Error parsing time:", err) // This will tell you why it failed
-		return nil
-	}
 	loc, _ := time.LoadLocation("Asia/Jakarta")
-	fmt.Println("Original (UTC):", t.String())
 
 	// 3. Convert and format
-	wibTime := t.In(loc)
+	wibTime := invoice.ExpiredAt.In(loc)
 	displayTime := wibTime.Format("02-01-2006 15:04:05")
 
 	msg.WriteString("💎 <b>Pembayaran Paket VIP (QRIS)</b>\n\n")
 	msg.WriteString(fmt.Sprintf("💲 Nominal : %s\n", formatted))
 	msg.WriteString(fmt.Sprintf("🔐 Paket VIP : %d hari\n", duration))
+	if recipient != nil {
+		msg.WriteString(fmt.Sprintf("🎁 Hadiah untuk : %s\n", html.EscapeString(giftRecipientName(recipient))))
+	}
+	if tx.VoucherCode != "" {
+		msg.WriteString(fmt.Sprintf("🎟️ Voucher : %s", tx.VoucherCode))
+		if tx.Discount > 0 {
+			msg.WriteString(p.Sprintf(" (hemat Rp %d)", tx.Discount))
+		}
+		if tx.VoucherDays > 0 {
+			msg.WriteString(fmt.Sprintf(" (+%d hari)", tx.VoucherDays))
+		}
+		msg.WriteString("\n")
+	}
 	msg.WriteString(fmt.Sprintf("🧾 ID Transaksi : %s\n\n", transactionID))
 	msg.WriteString(fmt.Sprintf("✅ Berlaku sampai : %s ✅", displayTime))
 
@@ -594,22 +561,40 @@ func handleWebhook(w http.ResponseWriter, r *http.Request, bot *telebot.Bot) {
 		return
 	}
 
-	var payload map[string]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	event, err := paymentProvider.ParseWebhook(r)
+	if err != nil {
+		log.Printf("⚠️ Invalid %s webhook: %v", paymentProvider.Name(), err)
+		http.Error(w, "Invalid payload", http.StatusBadRequest)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 
-	go processPaymentWebhook(payload, w, bot)
+	go processPaymentWebhook(event, bot)
+}
+
+func processPaymentWebhook(event *payment.WebhookEvent, bot *telebot.Bot) {
+	log.Printf("🔔 Received Order ID: %s", event.OrderID)
+
+	if event.Status != payment.StatusCompleted {
+		log.Printf("ℹ️ Ignoring %s webhook for %s with status %s", paymentProvider.Name(), event.OrderID, event.Status)
+		return
+	}
+
+	if err := activatePayment(event.OrderID, event.Amount, event.PayerName, bot); err != nil {
+		log.Printf("🚫 Webhook for %s not activated: %v", event.OrderID, err)
+	}
 }
 
-func processPaymentWebhook(payload map[string]interface{}, w http.ResponseWriter, bot *telebot.Bot) {
-	amount, _ := payload["amount"].(float64)
-	order_id, _ := payload["order_id"].(string)
-	log.Printf("🔔 Received Order ID: %s", order_id)
+// errNeedsReview is returned by activatePayment when a paid order was handed
+// to the owner's review queue instead of being activated.
+var errNeedsReview = errors.New("payment held for owner review")
 
+// activatePayment verifies order_id with the gateway and grants exactly the
+// package recorded on the transaction. It is shared by the webhook and the
+// pending-transaction reconciler. payerName is the QRIS payer reported by the
+// gateway, if any.
+func activatePayment(order_id string, amount int, payerName string, bot *telebot.Bot) error {
 	lock := getPaymentLock(order_id)
 	lock.Lock()
 	defer lock.Unlock()
@@ -617,182 +602,383 @@ func processPaymentWebhook(payload map[string]interface{}, w http.ResponseWriter
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	verifiedTx, paidAmount, err := verifyPayment(ctx, order_id, amount)
+	if err != nil {
+		return err
+	}
+	var set bson.M
+	if name := normalizePayerName(payerName); name != "" {
+		set = bson.M{"payer_name": name}
+	}
+	return completePayment(ctx, bot, verifiedTx, paidAmount, "verified with "+paymentProvider.Name(), set)
+}
+
+// completePayment activates a transaction whose payment has been confirmed
+// by its provider, or queues it for review when it cannot be activated
+// automatically. Extra fields in set are stored with the paid state. The
+// caller must hold the payment lock.
+func completePayment(ctx context.Context, bot *telebot.Bot, verifiedTx *models.Transaction, paidAmount int, note string, set bson.M) error {
+	if reason := paymentReviewReason(verifiedTx, paidAmount); reason != "" {
+		queueForReview(ctx, bot, verifiedTx, paidAmount, reason, set)
+		return errNeedsReview
+	}
+
+	fields := bson.M{"paid_amount": paidAmount}
+	for k, v := range set {
+		fields[k] = v
+	}
+
+	var result *activation
+	err := withTransaction(ctx, func(sc mongo.SessionContext) error {
+		paidTx, err := transitionTransaction(sc, verifiedTx.TransactionID, models.StatePaid, note, fields)
+		if err != nil {
+			return err
+		}
+		result, err = grantTransaction(sc, paidTx, nil)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	result.notify(bot)
+	log.Printf("✅ VIP activated for user ID %d with transaction ID %s (duration: %d hari)", verifiedTx.TelegramID, verifiedTx.TransactionID, result.duration)
+	return nil
+}
+
+// paymentReviewReason says why a confirmed payment of paidAmount for tx
+// cannot be activated automatically, or "" when it can.
+func paymentReviewReason(tx *models.Transaction, paidAmount int) string {
+	switch {
+	case tx.State == models.StateCancelled:
+		// The user cancelled this invoice but paid anyway
+		return models.ReviewPaidAfterCancel
+	case paidAmount < tx.Amount:
+		return models.ReviewUnderpaid
+	case paidAmount > tx.Amount:
+		return models.ReviewOverpaid
+	}
+	return ""
+}
+
+// withTransaction runs fn inside a MongoDB transaction, committing on
+// success and aborting on error.
+func withTransaction(ctx context.Context, fn func(sc mongo.SessionContext) error) error {
 	session, err := database.GetClient().StartSession()
 	if err != nil {
 		log.Printf("❌ Failed to start session: %v", err)
-		return
+		return err
 	}
 	defer session.EndSession(ctx)
 
-	err = mongo.WithSession(ctx, session, func(sc mongo.SessionContext) error {
+	return mongo.WithSession(ctx, session, func(sc mongo.SessionContext) error {
 		// Start transaction
 		if err := session.StartTransaction(); err != nil {
 			return err
 		}
 
-		pendingCol := database.GetTransactionPendingCollection()
-		successCol := database.GetTransactionSuccessCollection()
-		userCol := database.GetUserCollection()
-
-		var existing models.TransactionSuccess
-		err := successCol.FindOne(sc, bson.M{"transactionID": order_id}).Decode(&existing)
-		if err == nil {
-			log.Printf("⚠️ Already processed: %s", order_id)
+		if err := fn(sc); err != nil {
 			session.AbortTransaction(sc)
-			return nil
+			return err
 		}
 
-		// Get pending transaction
-		var pendingTx models.TransactionPending
-		err = pendingCol.FindOne(sc, bson.M{"transactionID": order_id}).Decode(&pendingTx)
-		if err != nil {
-			session.AbortTransaction(sc)
-			return err
+		// ✅ Commit transaction
+		return session.CommitTransaction(sc)
+	})
+}
+
+// activation is what grantTransaction changed, kept for the notifications
+// sent once the MongoDB transaction has committed.
+type activation struct {
+	transactionID    string
+	payer            models.User
+	updatedUser      models.User // yang menerima VIP, pembeli atau penerima hadiah
+	gift             bool
+	referrer         models.User
+	duration         int
+	bonusForReferrer int
+	referrerCredited bool
+	hold             *models.ReferralHold
+}
+
+func (a *activation) notify(bot *telebot.Bot) {
+	if a.gift {
+		go sendGiftNotification(bot, &a.payer, &a.updatedUser, a.duration)
+	} else {
+		go sendPaymentNotification(bot, a.payer.TelegramUserID, a.duration, &a.updatedUser)
+	}
+	if a.referrerCredited {
+		go sendReferralNotification(bot, &a.referrer, &a.payer, a.bonusForReferrer)
+	}
+	if a.hold != nil {
+		go notifyReferralHold(bot, a.transactionID, &a.payer, a.hold)
+	}
+}
+
+// grantTransaction extends VIP for a paid transaction's package plus any
+// referral bonuses and moves it to activated. Gifts extend the recipient
+// instead of the payer. It must run inside sc.
+func grantTransaction(sc mongo.SessionContext, tx *models.Transaction, extra bson.M) (*activation, error) {
+	userCol := database.GetUserCollection()
+
+	var payer models.User
+	err := userCol.FindOne(sc, bson.M{"telegram_user_id": tx.TelegramID}).Decode(&payer)
+	if err != nil {
+		return nil, err
+	}
+
+	duration := tx.Duration
+	gift := tx.RecipientID != 0
+	beneficiaryID := tx.TelegramID
+	if gift {
+		beneficiaryID = tx.RecipientID
+	}
+
+	bonusForPayer := 0
+	bonusForReferrer := 0
+	if payer.ReferralCode != "" {
+		// payer gets 100% bonus, max 7 (not on gifts, the payer gets no VIP)
+		if duration > 0 && !gift {
+			bonusForPayer = duration
+			if bonusForPayer > 7 {
+				bonusForPayer = 7
+			}
+		}
+		// referrer gets same as payer's package, max 3
+		bonusForReferrer = duration
+		if bonusForReferrer > 3 {
+			bonusForReferrer = 3
 		}
+	}
+
+	// Indonesian timezone
+	now := GetJakartaTime()
 
-		var payer models.User
-		err = userCol.FindOne(ctx, bson.M{"telegram_user_id": pendingTx.TelegramID}).Decode(&payer)
+	// Bonus referral yang mencurigakan ditahan sampai owner memutuskan
+	var hold *models.ReferralHold
+	if payer.ReferralCode != "" {
+		hold, err = checkReferral(sc, tx, &payer, bonusForPayer, bonusForReferrer, now)
 		if err != nil {
-			session.AbortTransaction(sc)
-			return err
+			return nil, err
 		}
-
-		_, duration := getPackages(int(amount))
-		if duration <= 0 {
-			duration = 0 // default fallback
+		if hold != nil {
+			bonusForPayer, bonusForReferrer = 0, 0
 		}
+	}
 
-		bonusForPayer := 0
-		bonusForReferrer := 0
-		if payer.ReferralCode != "" {
-			// payer gets 100% bonus, max 7
-			if duration > 0 {
-				bonusForPayer = duration
-				if bonusForPayer > 7 {
-					bonusForPayer = 7
-				}
-			}
-			// referrer gets same as payer's package, max 3
-			bonusForReferrer = duration
-			if bonusForReferrer > 3 {
-				bonusForReferrer = 3
-			}
-		}
+	finalDuration := duration + tx.VoucherDays + bonusForPayer
+	result := &activation{transactionID: tx.TransactionID, payer: payer, gift: gift, duration: duration + tx.VoucherDays, bonusForReferrer: bonusForReferrer, hold: hold}
 
-		finalDuration := duration + bonusForPayer
+	// Update expire_time without querying first
+	result.updatedUser, err = extendVIP(sc, beneficiaryID, finalDuration, now)
+	if err != nil {
+		log.Printf("❌ Failed to update user VIP: %v", err)
+		return nil, err
+	}
 
-		// Indonesian timezone
-		now := GetJakartaTime()
-		var updatedUser models.User
-		// Update expire_time without querying first
-
-		err = userCol.FindOneAndUpdate(sc,
-			bson.M{"telegram_user_id": pendingTx.TelegramID},
-			mongo.Pipeline{
-				{{
-					Key: "$set",
-					Value: bson.D{
-						{
-							Key: "expire_time",
-							Value: bson.D{
-								{
-									Key: "$cond",
-									Value: bson.A{
-										bson.D{{Key: "$gt", Value: bson.A{"$expire_time", now}}},
-										bson.D{{Key: "$dateAdd", Value: bson.D{
-											{Key: "startDate", Value: "$expire_time"},
-											{Key: "unit", Value: "day"},
-											{Key: "amount", Value: finalDuration},
-										}}},
-										now.AddDate(0, 0, finalDuration),
-									},
-								},
-							},
-						},
-						{Key: "is_vip", Value: true},
-					},
-				}},
-			},
-			options.FindOneAndUpdate().SetReturnDocument(options.After),
-		).Decode(&updatedUser)
+	var payouts []models.ReferralPayout
+	if bonusForReferrer > 0 {
+		referrer, err := creditReferrer(sc, tx, &payer, bonusForReferrer, now)
 		if err != nil {
-			log.Printf("❌ Failed to update user VIP: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return nil
+			return nil, err
+		}
+		if referrer != nil {
+			result.referrer = *referrer
+			result.referrerCredited = true
+			payouts = append(payouts, models.ReferralPayout{
+				TelegramID: referrer.TelegramUserID,
+				Code:       payer.ReferralCode,
+				Days:       bonusForReferrer,
+			})
 		}
+	}
+
+	set := bson.M{
+		"bonus_days":       bonusForPayer,
+		"referral_code":    payer.ReferralCode,
+		"referral_payouts": payouts,
+		"activated_at":     now,
+	}
+	if hold != nil {
+		set["referral_hold"] = hold
+	}
+	for k, v := range extra {
+		set[k] = v
+	}
+	if _, err := transitionTransaction(sc, tx.TransactionID, models.StateActivated, "", set); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
 
-		if payer.ReferralCode != "" && bonusForReferrer > 0 {
-			var referrer models.User
-			err := userCol.FindOneAndUpdate(sc,
-				bson.M{"code": payer.ReferralCode},
-				mongo.Pipeline{
-					{{
-						Key: "$set",
+// extendVIP adds days of VIP to a user, counting from their current expiry
+// if it is still running.
+func extendVIP(sc mongo.SessionContext, telegramID int64, days int, now time.Time) (models.User, error) {
+	var user models.User
+	err := database.GetUserCollection().FindOneAndUpdate(sc,
+		bson.M{"telegram_user_id": telegramID},
+		mongo.Pipeline{
+			{{
+				Key: "$set",
+				Value: bson.D{
+					{
+						Key: "expire_time",
 						Value: bson.D{
 							{
-								Key: "expire_time",
-								Value: bson.D{
-									{
-										Key: "$cond",
-										Value: bson.A{
-											bson.D{{Key: "$gt", Value: bson.A{"$expire_time", now}}},
-											bson.D{{Key: "$dateAdd", Value: bson.D{
-												{Key: "startDate", Value: "$expire_time"},
-												{Key: "unit", Value: "day"},
-												{Key: "amount", Value: bonusForReferrer},
-											}}},
-											now.AddDate(0, 0, bonusForReferrer),
-										},
-									},
+								Key: "$cond",
+								Value: bson.A{
+									bson.D{{Key: "$gt", Value: bson.A{"$expire_time", now}}},
+									bson.D{{Key: "$dateAdd", Value: bson.D{
+										{Key: "startDate", Value: "$expire_time"},
+										{Key: "unit", Value: "day"},
+										{Key: "amount", Value: days},
+									}}},
+									now.AddDate(0, 0, days),
 								},
 							},
-							{Key: "is_vip", Value: true},
 						},
-					}},
+					},
+					{Key: "is_vip", Value: true},
 				},
-				options.FindOneAndUpdate().SetReturnDocument(options.After),
-			).Decode(&referrer)
-			if err != nil {
-				log.Printf("⚠️ Failed to update referrer VIP: %v", err)
-			} else {
-				go sendReferralNotification(bot, &referrer, &payer, bonusForReferrer)
-			}
-		}
+			}},
+			reminderResetStage(now),
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	return user, err
+}
 
-		// Simpan ke transactionSuccess
+// creditReferrer gives the owner of payer's referral code days of VIP and
+// the matching referral balance for tx. It returns nil without an error when
+// the referrer cannot be credited. It must run inside sc.
+func creditReferrer(sc mongo.SessionContext, tx *models.Transaction, payer *models.User, days int, now time.Time) (*models.User, error) {
+	var referrer models.User
+	err := database.GetUserCollection().FindOne(sc, bson.M{"code": payer.ReferralCode}).Decode(&referrer)
+	if err == nil {
+		referrer, err = extendVIP(sc, referrer.TelegramUserID, days, now)
+	}
+	if err != nil {
+		log.Printf("⚠️ Failed to update referrer VIP: %v", err)
+		return nil, nil
+	}
 
-		successTx := models.TransactionSuccess{
-			TransactionID: pendingTx.TransactionID,
-			TelegramID:    pendingTx.TelegramID,
-			ActivatedAt:   now,
-			Duration:      duration,
-			ReferralCode:  payer.ReferralCode,
-		}
+	err = recordGrant(sc, models.VIPGrant{
+		TelegramID:    referrer.TelegramUserID,
+		Type:          models.GrantReferral,
+		Days:          days,
+		TransactionID: tx.TransactionID,
+		Note:          payer.TelegramName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = adjustReferralBalance(sc, models.ReferralLedgerEntry{
+		TelegramID:    referrer.TelegramUserID,
+		Type:          models.LedgerBonus,
+		Amount:        days * models.ReferralPayoutRate,
+		Days:          days,
+		TransactionID: tx.TransactionID,
+		Note:          payer.TelegramName,
+	}, false)
+	if err != nil {
+		return nil, err
+	}
+	return &referrer, nil
+}
 
-		_, err = successCol.InsertOne(ctx, successTx)
-		if err != nil {
-			log.Printf("❌ Failed to save to transactionSuccess: %v", err)
-		}
+// verifyPayment makes sure a webhook refers to one of our open invoices and
+// asks the gateway itself whether, and how much, was paid. The webhook
+// amount is never trusted.
+func verifyPayment(ctx context.Context, orderID string, amount int) (*models.Transaction, int, error) {
+	tx, err := getTransaction(ctx, orderID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("transaction not found: %w", err)
+	}
+	if !tx.State.CanTransition(models.StatePaid) {
+		return nil, 0, fmt.Errorf("transaction is already %s", tx.State)
+	}
+	if amount != tx.Amount {
+		log.Printf("⚠️ Webhook amount %d for %s differs from invoice amount %d", amount, orderID, tx.Amount)
+	}
 
-		// Hapus dari pending
+	paidAmount, err := queryPaidAmount(ctx, paymentProvider, tx)
+	if err != nil {
+		return nil, 0, err
+	}
+	return tx, paidAmount, nil
+}
 
-		_, err = pendingCol.DeleteOne(ctx, bson.M{"trasactionID": order_id})
-		if err != nil {
-			session.AbortTransaction(sc)
-			return err
-		}
+// queryPaidAmount asks provider how much was paid for tx. It fails with
+// payment.ErrNotPaid unless the gateway reports tx's own order as completed.
+func queryPaidAmount(ctx context.Context, provider payment.PaymentProvider, tx *models.Transaction) (int, error) {
+	status, err := provider.QueryStatus(ctx, tx.TransactionID, tx.Amount)
+	if err != nil {
+		return 0, err
+	}
+	if status.OrderID != tx.TransactionID || status.Status != payment.StatusCompleted {
+		return 0, payment.ErrNotPaid
+	}
+	return status.Amount, nil
+}
 
-		// ✅ Commit transaction
-		if err := session.CommitTransaction(sc); err != nil {
-			return err
-		}
+// handleCancelPayment cancels the QRIS invoice at the gateway and moves the
+// transaction to cancelled so a late webhook cannot activate it.
+func handleCancelPayment(c telebot.Context) error {
+	data := strings.Split(c.Data(), "|")
+	transactionID := data[0]
 
-		// Send notification (outside transaction)
-		go sendPaymentNotification(bot, pendingTx.TelegramID, duration, &updatedUser)
+	lock := getPaymentLock(transactionID)
+	lock.Lock()
+	defer lock.Unlock()
 
-		log.Printf("✅ VIP activated for user ID %d with transaction ID %s (duration: %d hari)", pendingTx.TelegramID, order_id, duration)
-		return nil
-	})
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := getTransaction(ctx, transactionID)
+	if err != nil || tx.TelegramID != c.Sender().ID {
+		log.Printf("⚠️ Cancel for unknown transaction %s: %v", transactionID, err)
+		return c.Respond(&telebot.CallbackResponse{Text: "Tagihan sudah tidak berlaku."})
+	}
+	if tx.State == models.StateCancelled {
+		return c.Respond(&telebot.CallbackResponse{Text: "Tagihan sudah dibatalkan."})
+	}
+	if !tx.State.CanTransition(models.StateCancelled) {
+		return c.Respond(&telebot.CallbackResponse{Text: "Tagihan sudah tidak berlaku."})
+	}
+
+	if err := paymentProvider.CancelInvoice(ctx, transactionID, tx.Amount); err != nil {
+		log.Printf("❌ Failed to cancel %s via %s: %v", transactionID, paymentProvider.Name(), err)
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ Gagal membatalkan pembayaran. Coba lagi nanti.", ShowAlert: true})
+	}
+
+	if cancelled, err := transitionTransaction(ctx, transactionID, models.StateCancelled, "cancelled by user", nil); err != nil {
+		log.Printf("❌ Failed to mark %s as cancelled: %v", transactionID, err)
+	} else {
+		releaseVoucher(ctx, cancelled)
+	}
+	log.Printf("🛑 Transaction %s cancelled by user %d", transactionID, c.Sender().ID)
+
+	lastVideoMessagesMu.RLock()
+	if lastMsg, ok := lastVideoMessages[c.Chat().ID]; ok {
+		_ = c.Bot().Delete(lastMsg)
+	}
+	lastVideoMessagesMu.RUnlock()
+
+	_ = c.Respond()
+	return c.Send(fmt.Sprintf("✅ Pembayaran <code>%s</code> dibatalkan.", transactionID), telebot.ModeHTML)
+}
+
+// notifyOwner sends an HTML message to BOT_OWNER_ID. opts are passed to
+// bot.Send, e.g. a reply markup with action buttons.
+func notifyOwner(bot *telebot.Bot, msg string, opts ...interface{}) {
+	ownerID, err := strconv.ParseInt(os.Getenv("BOT_OWNER_ID"), 10, 64)
+	if err != nil {
+		log.Printf("⚠️ Invalid BOT_OWNER_ID: %v", err)
+		return
+	}
+	if _, err := bot.Send(&telebot.User{ID: ownerID}, msg, append(opts, telebot.ModeHTML)...); err != nil {
+		log.Printf("⚠️ Failed to notify owner: %v", err)
+	}
 }
 
 func sendReferralNotification(bot *telebot.Bot, referrer *models.User, payer *models.User, bonus int) {
@@ -801,7 +987,7 @@ func sendReferralNotification(bot *telebot.Bot, referrer *models.User, payer *mo
 		"🎉 <b>Bonus VIP!</b>\n\n"+
 			"👤 Teman kamu <b>%s</b> baru berlangganan VIP.\n"+
 			"🎁 Kamu dapat tambahan VIP <b>%d Hari</b>!",
-		payer.TelegramName, bonus,
+		html.EscapeString(payer.TelegramName), bonus,
 	)
 	bot.Send(recipient, msg, telebot.ModeHTML)
 }
@@ -817,12 +1003,6 @@ func sendPaymentNotification(bot *telebot.Bot, userID int64, duration int, user
 	bot.Send(recipient, msg, telebot.ModeHTML)
 }
 
-func sameDay(t1, t2 time.Time) bool {
-	y1, m1, d1 := t1.Date()
-	y2, m2, d2 := t2.Date()
-	return y1 == y2 && m1 == m2 && d1 == d2
-}
-
 func sendVideo(c telebot.Context, slug string) error {
 	user := c.Sender()
 	chatID := user.ID
@@ -854,7 +1034,6 @@ func sendVideo(c telebot.Context, slug string) error {
 			"telegram_username": user.Username,
 			"telegram_user_id":  user.ID,
 			"is_vip":            false,
-			"daily_limit":       10,
 			"created_at":        now,
 			"code":              generateUniqueCode(),
 		},
@@ -874,42 +1053,14 @@ func sendVideo(c telebot.Context, slug string) error {
 	}
 
 	// ============================================
-	// OPTIMIZATION 2: Reset daily limit if new day
-	// ============================================
-	if !sameDay(existingUser.LastAccess, now) {
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-		existingUser.DailyLimit = 10
-		// Update immediately in single query
-		_, err := userCollection.UpdateOne(
-			ctx,
-			bson.M{"telegram_user_id": user.ID},
-			bson.M{"$set": bson.M{"daily_limit": 10}},
-		)
-		if err != nil {
-			log.Println("⚠️ Failed to reset daily limit:", err)
-		}
-	}
-
-	// ============================================
-	// OPTIMIZATION 3: Handle VIP expiration
+	// OPTIMIZATION 2: VIP lapsed since the last expiry sweep
 	// ============================================
 	if existingUser.ExpireTime != nil && existingUser.ExpireTime.Before(now) {
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-		_, err := userCollection.UpdateOne(
-			ctx,
-			bson.M{"telegram_user_id": user.ID},
-			bson.M{"$set": bson.M{"expire_time": nil, "is_vip": false}},
-		)
-		if err != nil {
-			log.Println("⚠️ Failed to update VIP status:", err)
-		}
 		existingUser.IsVIP = false
 	}
 
 	// ============================================
-	// OPTIMIZATION 4: Get video from cache first
+	// OPTIMIZATION 3: Get video from cache first
 	// ============================================
 	var video models.Video
 
@@ -930,35 +1081,24 @@ func sendVideo(c telebot.Context, slug string) error {
 	// ============================================
 	// VIP Check
 	// ============================================
-	if video.VIPOnly && !existingUser.IsVIP {
-		return c.Send("🔐 Video ini hanya bisa diakses oleh pengguna VIP.\n\nKetik /vip untuk upgrade.")
+	if !isFreePart(video.Part) && !existingUser.IsVIP {
+		return c.Send(fmt.Sprintf("🔐 Hanya %d part pertama tiap drama yang gratis. Part ini khusus pengguna VIP.\n\nKetik /vip untuk upgrade.", freePartsPerDrama()))
 	}
 
 	// ============================================
-	// OPTIMIZATION 5: Batch limit update with other fields
+	// OPTIMIZATION 4: Spend free quota atomically
 	// ============================================
 	if !existingUser.IsVIP {
-		if existingUser.DailyLimit <= 0 {
-			return c.Send("❌ Batas harian kamu sudah habis. Silakan tunggu besok atau upgrade VIP.")
-		}
-
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
-		// Single update query instead of separate ones
-		_, err := userCollection.UpdateOne(
-			ctx,
-			bson.M{"telegram_user_id": user.ID},
-			bson.M{
-				"$inc": bson.M{"daily_limit": -1}, // Decrement atomically
-				"$set": bson.M{"last_access": now},
-			},
-		)
-		if err != nil {
-			log.Println("❌ Failed to update user limit:", err)
+		if _, err := consumeQuota(ctx, user.ID, now); err != nil {
+			if err == errQuotaExhausted {
+				return c.Send("❌ Kuota nonton gratis kamu hari ini sudah habis. Kuota direset pukul 00.00 WIB, atau upgrade VIP untuk nonton tanpa batas.\n\nKetik /vip untuk upgrade.")
+			}
+			log.Println("❌ Failed to update user quota:", err)
+			return c.Send("❌ Terjadi kesalahan sistem.")
 		}
-
-		existingUser.DailyLimit--
 	}
 
 	// ============================================
@@ -971,12 +1111,13 @@ func sendVideo(c telebot.Context, slug string) error {
 	nextBtn = partMenu.Data("Next Part", "next_part", fmt.Sprintf("%s|%d", slug, nextPart))
 	prevBtn = partMenu.Data("Previous Part", "prev_part", fmt.Sprintf("%s|%d", slug, prevPart))
 
+	favRow := partMenu.Row(favoriteBtn(partMenu, dramaSlugOf(slug)))
 	if video.Part == 1 {
-		partMenu.Inline(partMenu.Row(nextBtn))
+		partMenu.Inline(partMenu.Row(nextBtn), favRow)
 	} else if video.Part == video.TotalPart {
-		partMenu.Inline(partMenu.Row(prevBtn))
+		partMenu.Inline(partMenu.Row(prevBtn), favRow)
 	} else {
-		partMenu.Inline(partMenu.Row(prevBtn, nextBtn))
+		partMenu.Inline(partMenu.Row(prevBtn, nextBtn), favRow)
 	}
 
 	options := &telebot.SendOptions{
@@ -1012,6 +1153,11 @@ func sendVideo(c telebot.Context, slug string) error {
 	lastVideoMessages[chatID] = sentMsg
 	lastVideoMessagesMu.Unlock()
 
+	// Next/prev dan deep link semua lewat sini, jadi progres selalu ikut
+	if sentMsg != nil {
+		recordWatchProgress(user.ID, video)
+	}
+
 	return nil
 }
 
@@ -1064,6 +1210,11 @@ func processReferral(c telebot.Context, code string) error {
 		return c.Send("❌ You cannot use your own referral code.")
 	}
 
+	// Prevent circular referrals (A refers B, B refers A)
+	if referrer.ReferralCode != "" && referrer.ReferralCode == currentUser.Code {
+		return c.Send("❌ You cannot use the referral code of someone you referred.")
+	}
+
 	// Save the referral code to current user
 	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -1084,6 +1235,11 @@ const requiredChannelID = int64(-1002820138086) // Your channel ID
 
 func MustJoinChannel(next telebot.HandlerFunc) telebot.HandlerFunc {
 	return func(c telebot.Context) error {
+		// Inline query dijawab untuk siapa saja; cek join terjadi saat
+		// tombol Tonton membuka bot
+		if c.Query() != nil {
+			return next(c)
+		}
 		chat := &telebot.Chat{ID: requiredChannelID}
 
 		member, err := c.Bot().ChatMemberOf(chat, c.Sender())
@@ -1132,9 +1288,6 @@ func main() {
 
 	log.Print(now.Format("02 January 2006 - 15:04"))
 
-	var waitingForReferralMu sync.RWMutex
-	var waitingForReferral = make(map[int64]bool)
-
 	mongoURI := os.Getenv("MONGO_URI")
 	dbName := os.Getenv("MONGO_DB")
 
@@ -1146,6 +1299,23 @@ func main() {
 	}
 	defer database.Disconnect()
 
+	if os.Getenv("PAYMENT_PROVIDER") == "fake" {
+		paymentProvider = payment.NewFakeProvider()
+	} else {
+		paymentProvider = payment.NewPakasir()
+	}
+
+	if err := database.EnsureIndexes(ctx); err != nil {
+		log.Printf("⚠️ Failed to ensure indexes: %v", err)
+	}
+	if err := seedPackages(ctx); err != nil {
+		log.Printf("⚠️ Failed to seed VIP packages: %v", err)
+	}
+
+	// Background jobs: reconciler, VIP reminders, expiry sweeper
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
 	// redisClient = redis.NewClient(&redis.Options{
 	// 	Addr:     os.Getenv("REDIS_ADDR"), // example: "localhost:6379"
 	// 	Password: "",                      // or from env if set
@@ -1170,6 +1340,9 @@ func main() {
 		log.Fatal(err)
 	}
 
+	// Kiriman massal dari semua job berbagi satu batas kecepatan
+	jobNotifier := newNotifier(bot, broadcastRate)
+
 	bot.Use(middleware.AntiSpamCommands)
 
 	bot.Use(func(next telebot.HandlerFunc) telebot.HandlerFunc {
@@ -1182,6 +1355,15 @@ func main() {
 			if c.Sender().ID == ownerID {
 				return next(c)
 			}
+			// Inline query tidak punya chat; hasilnya memang untuk dibagikan
+			if c.Query() != nil {
+				return next(c)
+			}
+			// Pre-checkout Stars juga tanpa chat, dan panic di sini
+			// menjatuhkan seluruh bot
+			if c.PreCheckoutQuery() != nil || c.Chat() == nil {
+				return next(c)
+			}
 			if c.Chat().Type != telebot.ChatPrivate {
 				// You can also silently ignore:
 				// return nil
@@ -1194,7 +1376,7 @@ func main() {
 	bot.Use(MustJoinChannel)
 
 	// Buttons
-	menu.Inline(menu.Row(startBtn), menu.Row(vipBtn, statusBtn))
+	menu.Inline(menu.Row(startBtn, continueBtn), menu.Row(vipBtn, statusBtn))
 
 	bot.Handle("/spamstats", func(c telebot.Context) error {
 		stats := middleware.GetUserStats(c.Sender().ID)
@@ -1223,14 +1405,14 @@ func main() {
 
 	// Handle /start
 	bot.Handle("/start", func(c telebot.Context) error {
-		slug := c.Data()
+		start := parseStartPayload(c.Data())
 		user := c.Sender()
 
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
-		if slug != "" {
-			sendVideo(c, slug)
+		if start.Kind == startVideo {
+			sendVideo(c, start.Value)
 			return nil
 		}
 
@@ -1240,23 +1422,27 @@ func main() {
 		ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 		err := userCollection.FindOne(ctx, filter).Decode(&existingUser)
+		isNewUser := false
 		if err != nil {
 			newUser := models.User{
 				TelegramName:     strings.TrimSpace(user.FirstName + " " + user.LastName),
 				TelegramUsername: user.Username,
 				TelegramUserID:   user.ID,
 				IsVIP:            false,
-				DailyLimit:       10,
 				LastAccess:       now,
 				CreatedAt:        now,
 				Code:             generateUniqueCode(),
 			}
+			if start.Kind == startCampaign {
+				newUser.StartSource = start.Value
+			}
 			ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
 			defer cancel()
 			_, err := userCollection.InsertOne(ctx, newUser)
 			if err != nil {
 				log.Println("❌ Failed to insert user:", err)
 			} else {
+				isNewUser = true
 				log.Printf("✅ New user saved: %s (%s)", newUser.TelegramName, newUser.TelegramUsername)
 			}
 		}
@@ -1268,34 +1454,45 @@ func main() {
 				"Langsung tonton dari Telegram tanpa harus buka aplikasi lain.\n"+
 				"Klik tombol di bawah buat mulai 🎥\n\n"+
 				"🎁 <b>Program Referral VIP Gratis!</b>\n"+
-				"Undang temanmu untuk join DRAMATRANS pakai kode referral kamu (lihat di /status) dan dapatkan VIP GRATIS sesuai durasi VIP yang dibeli temanmu — hingga <b>maksimal 3 hari</b>! 💎\n"+
+				"Undang temanmu untuk join DRAMATRANS pakai kode referral kamu (lihat di /referrals) dan dapatkan VIP GRATIS sesuai durasi VIP yang dibeli temanmu — hingga <b>maksimal 3 hari</b>! 💎\n"+
 				"Temanmu juga akan dapat <b>bonus durasi 100%%</b> dari paket VIP yang mereka beli (maksimal 7 hari). 🤝\n"+
 				"<b>Bonus Referral bisa diuangkan</b> dan akan mendapatkan 20%% dari total durasi, estimasi hitungan per hari sebesar Rp400.\n"+
-				"Contoh: total durasi kamu yang didapatkan dari bonus referral sebanyak 10 hari (10 X Rp400 = Rp4000)\n\n"+
+				"Contoh: total durasi kamu yang didapatkan dari bonus referral sebanyak 10 hari (10 X Rp400 = Rp4000)\n"+
+				"Cek saldo dan cairkan lewat <b>/payout</b>.\n\n"+
 				"🔑 Mau pakai referral code dari teman? Ketik <b>/referral</b> lalu masukkan kodenya.\n\n"+
 				"Kalau ada yang mau ditanya, chat aja admin @domi_nuc ya!",
 			getGreeting(), user.FirstName,
 		)
 
-		return c.Send(welcome, menu, telebot.ModeHTML)
+		if err := c.Send(welcome, menu, telebot.ModeHTML); err != nil {
+			return err
+		}
+		if start.Kind == startReferral {
+			// Link referral hanya berlaku saat pertama kali bergabung
+			if isNewUser {
+				return processReferral(c, start.Value)
+			}
+			return c.Send("ℹ️ Link referral hanya berlaku untuk pengguna baru. Kalau belum pernah memasang kode, ketik /referral.")
+		}
+		return nil
 	})
 
 	// 🎬 Mulai Nonton
-	bot.Handle(&startBtn, func(c telebot.Context) error {
-		msg := "🎬 <b>Cara Nonton Drama di DRAMATRANS</b>\n\n" +
-			"1️⃣ Buka channel 👉 @Dramatrans\n" +
-			"2️⃣ Temukan drama yang kamu mau:\n" +
-			"   • Gunakan fitur 🔍 pencarian & ketik judulnya\n" +
-			"   • Atau klik profil channel → masuk tab <b>Media</b>\n" +
-			"3️⃣ Klik judul atau part → tekan TONTON\n" +
-			"4️⃣ Bot akan otomatis kirim videonya ke kamu 🎥\n\n" +
-			"🔐 <b>Part VIP</b> hanya untuk yang sudah berlangganan\n" +
-			"❓ Ada pertanyaan? Hubungi admin: @domi_nuc"
-
-		reply := &telebot.ReplyMarkup{}
-		reply.Inline(reply.Row(backBtn))
-
-		return c.Edit(msg, reply, telebot.ModeHTML)
+	bot.Handle(&startBtn, handleCatalog)
+	bot.Handle("/katalog", handleCatalog)
+	bot.Handle(&continueBtn, handleContinueWatching)
+	bot.Handle("/lanjut", handleContinueWatching)
+	bot.Handle("/favorit", handleFavorites)
+	bot.Handle(&telebot.Btn{Unique: "fav_save"}, handleFavoriteSave)
+	bot.Handle(&telebot.Btn{Unique: "fav_remove"}, handleFavoriteRemove)
+	bot.Handle("/search", handleSearch)
+	bot.Handle(&telebot.Btn{Unique: "search_page"}, handleSearchPage)
+	bot.Handle(&telebot.Btn{Unique: "catalog"}, handleCatalog)
+	bot.Handle(&telebot.Btn{Unique: "catalog_tags"}, handleCatalogTags)
+	bot.Handle(&telebot.Btn{Unique: "drama"}, handleDramaDetail)
+	bot.Handle(&telebot.Btn{Unique: "drama_part"}, handleDramaPart)
+	bot.Handle(&telebot.Btn{Unique: "noop"}, func(c telebot.Context) error {
+		return c.Respond()
 	})
 
 	// 💎 Langganan VIP
@@ -1306,12 +1503,26 @@ func main() {
 	bot.Handle(&statusBtn, handleStatus)
 	bot.Handle("/status", handleStatus)
 
-	bot.Handle("/referral", func(c telebot.Context) error {
-		waitingForReferralMu.Lock()
-		waitingForReferral[c.Sender().ID] = true
-		waitingForReferralMu.Unlock()
-		return c.Send("Please send me your referral code now.")
-	})
+	// 🧾 Riwayat Transaksi
+	bot.Handle(&historyBtn, handleHistory)
+	bot.Handle("/history", handleHistory)
+	bot.Handle(&telebot.Btn{Unique: "history_page"}, handleHistory)
+
+	// 🔔 Pengingat masa aktif VIP
+	bot.Handle("/pengingat", handleReminderSettings)
+	bot.Handle(&telebot.Btn{Unique: "reminder_on"}, handleReminderSettings)
+	bot.Handle(&telebot.Btn{Unique: "reminder_off"}, handleReminderSettings)
+
+	bot.Handle("/referrals", handleReferrals)
+	bot.Handle("/referralholds", handleReferralHolds)
+	bot.Handle(&telebot.Btn{Unique: "referral_approve"}, handleReferralHoldDecision)
+	bot.Handle(&telebot.Btn{Unique: "referral_reject"}, handleReferralHoldDecision)
+
+	bot.Handle("/referral", handleReferralEnter)
+
+	// 💬 Input bertahap (kode referral, voucher, penerima hadiah, ...)
+	bot.Handle("/batal", handleCancelConversation)
+	bot.Handle(&cancelConversationBtn, handleCancelConversation)
 
 	bot.Handle("/process", func(c telebot.Context) error {
 		ownerID := os.Getenv("BOT_OWNER_ID")
@@ -1426,7 +1637,7 @@ func main() {
 				video := models.Video{
 					Title:      partTitle,
 					Slug:       partSlug,
-					VIPOnly:    i != 1, // part 1 gratis, lainnya VIP
+					VIPOnly:    !isFreePart(i), // part awal gratis, lainnya VIP
 					VideoURL:   videoURL,
 					UploadTime: now,
 					Part:       i,
@@ -1448,7 +1659,9 @@ func main() {
 
 			filter := bson.M{"slug": titleFolder}
 
-			err = dramaCol.FindOne(ctx, filter).Err()
+			var existing models.Drama
+			newPartsFrom := 0
+			err = dramaCol.FindOne(ctx, filter).Decode(&existing)
 
 			if err != nil && err != mongo.ErrNoDocuments {
 				// Error DB lain
@@ -1469,6 +1682,7 @@ func main() {
 					KeyWord:          "",
 					Cast:             "",
 					Tag:              "",
+					Cover:            coverUrl,
 					TelegramSeriesID: telegramLink,
 				}
 
@@ -1479,6 +1693,28 @@ func main() {
 				}
 
 				setCachedDrama(drama)
+			} else if totalPart > existing.TotalPart {
+				// Data SUDAH ada, tapi ada part baru → perbarui jumlah part
+				_, err = dramaCol.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"total_part": totalPart}})
+				if err != nil {
+					log.Println("❌ Gagal update total part drama:", err)
+					return c.Send("❌ Gagal menyimpan ke database.")
+				}
+				_, err = videoCol.UpdateMany(ctx,
+					bson.M{"slug": primitive.Regex{Pattern: "^" + regexp.QuoteMeta(titleFolder+"_part_")}},
+					bson.M{"$set": bson.M{"total_part": totalPart}},
+				)
+				if err != nil {
+					log.Println("⚠️ Gagal update total part video:", err)
+				}
+				// Cache part lama masih menyimpan total_part lama, sehingga
+				// part terakhirnya tidak punya tombol Next ke part baru
+				for i := 1; i <= existing.TotalPart; i++ {
+					invalidateCachedVideo(fmt.Sprintf("%s_part_%d", titleFolder, i))
+				}
+				newPartsFrom = existing.TotalPart + 1
+				existing.TotalPart = totalPart
+				log.Printf("🆕 Drama %s: part %d-%d baru", titleFolder, newPartsFrom, totalPart)
 			} else {
 				// Data SUDAH ada → tidak insert
 				log.Println("⏭️ Drama already exists:", titleFolder)
@@ -1555,6 +1791,11 @@ func main() {
 			}
 			generatePost(c, fmt.Sprint(row[0]), title, part)
 
+			if newPartsFrom > 0 {
+				// Diantrekan lewat notifier bersama, /process tidak menunggu
+				go notifyNewParts(jobsCtx, jobNotifier, existing, newPartsFrom, totalPart)
+			}
+
 			time.Sleep(2 * time.Second)
 
 			if err := os.RemoveAll(targetDir); err != nil {
@@ -1603,7 +1844,8 @@ func main() {
 		Data       []Playlet `json:"data"`
 	}
 
-	bot.Handle("/search", func(c telebot.Context) error {
+	// 🔍 Cari judul baru di flickreels untuk di-/process (owner)
+	bot.Handle("/flsearch", func(c telebot.Context) error {
 		ownerID := os.Getenv("BOT_OWNER_ID")
 		if fmt.Sprint(c.Sender().ID) != ownerID {
 			return c.Send("❌ Kamu tidak punya akses ke perintah ini.")
@@ -1712,31 +1954,42 @@ func main() {
 		return nil
 	})
 
-	bot.Handle(telebot.OnText, func(c telebot.Context) error {
-		waitingForReferralMu.RLock()
-		if waitingForReferral[c.Sender().ID] {
-			delete(waitingForReferral, c.Sender().ID) // remove state after receiving
-			code := strings.TrimSpace(c.Text())
-			waitingForReferralMu.RUnlock()
-			if code == "" {
-				return c.Send("Referral anda adalah ")
-			}
-			return processReferral(c, code)
-		}
-		return nil // ignore other messages
-	})
-
+	bot.Handle(telebot.OnText, handleConversationText)
+	bot.Handle(telebot.OnQuery, handleInlineQuery)
+
+	bot.Handle(&telebot.Btn{Unique: "buy_vip"}, handleCheckout)
+	bot.Handle(&telebot.Btn{Unique: "pay_vip"}, handlePayVIP)
+	bot.Handle(&telebot.Btn{Unique: "voucher_enter"}, handleVoucherEnter)
+	bot.Handle(&telebot.Btn{Unique: "gift_enter"}, handleGiftEnter)
+	bot.Handle(&telebot.Btn{Unique: "pay_stars"}, handlePayStars)
+	bot.Handle(telebot.OnCheckout, handleStarsPreCheckout)
+	bot.Handle(telebot.OnPayment, handleStarsPayment)
+	bot.Handle("/voucher", handleVoucherAdmin)
+	bot.Handle("/package", handlePackageAdmin)
+	bot.Handle("/review", handleReview)
+	bot.Handle(&telebot.Btn{Unique: "review_approve"}, handleReviewApprove)
+	bot.Handle(&telebot.Btn{Unique: "review_reject"}, handleReviewReject)
+	bot.Handle("/refund", handleRefund)
+	bot.Handle(&telebot.Btn{Unique: "refund_confirm"}, handleRefundConfirm)
+
+	// 💰 Pencairan saldo referral
+	bot.Handle("/payout", handlePayout)
+	bot.Handle("/payouts", handlePayoutQueue)
+	bot.Handle(&telebot.Btn{Unique: "payout_approve"}, handlePayoutDecision)
+	bot.Handle(&telebot.Btn{Unique: "payout_reject"}, handlePayoutDecision)
+
+	// Tombol lama yang masih ada di riwayat chat
 	bot.Handle(&telebot.Btn{Unique: "vip_1d"}, func(c telebot.Context) error {
-		return sendQris(c, "vip_1d")
+		return sendQris(c, checkoutOrder{Package: "vip_1d"})
 	})
 	bot.Handle(&telebot.Btn{Unique: "vip_3d"}, func(c telebot.Context) error {
-		return sendQris(c, "vip_3d")
+		return sendQris(c, checkoutOrder{Package: "vip_3d"})
 	})
 	bot.Handle(&telebot.Btn{Unique: "vip_7d"}, func(c telebot.Context) error {
-		return sendQris(c, "vip_7d")
+		return sendQris(c, checkoutOrder{Package: "vip_7d"})
 	})
 	bot.Handle(&telebot.Btn{Unique: "vip_30d"}, func(c telebot.Context) error {
-		return sendQris(c, "vip_30d")
+		return sendQris(c, checkoutOrder{Package: "vip_30d"})
 	})
 
 	// 🔙 Kembali
@@ -1749,22 +2002,12 @@ func main() {
 		)
 
 		reply := &telebot.ReplyMarkup{}
-		reply.Inline(reply.Row(startBtn), reply.Row(vipBtn, statusBtn))
+		reply.Inline(reply.Row(startBtn, continueBtn), reply.Row(vipBtn, statusBtn))
 
 		return c.Edit(welcome, reply, telebot.ModeHTML)
 	})
 
-	bot.Handle(&telebot.Btn{Unique: "cancel_payment"}, func(c telebot.Context) error {
-		log.Print(c.Chat().ID)
-
-		lastVideoMessagesMu.RLock()
-		if lastMsg, ok := lastVideoMessages[c.Chat().ID]; ok {
-			_ = bot.Delete(lastMsg)
-		}
-		lastVideoMessagesMu.RUnlock()
-
-		return nil
-	})
+	bot.Handle(&telebot.Btn{Unique: "cancel_payment"}, handleCancelPayment)
 
 	bot.Handle(&telebot.Btn{Unique: "next_part"}, func(c telebot.Context) error {
 		datas := c.Data() // e.g. "slug123|part2"
@@ -1838,7 +2081,7 @@ func main() {
 			video := models.Video{
 				Title:      partTitle,
 				Slug:       partSlug,
-				VIPOnly:    i != 1, // part 1 gratis, lainnya VIP
+				VIPOnly:    !isFreePart(i), // part awal gratis, lainnya VIP
 				VideoURL:   videoURL,
 				UploadTime: now,
 				Part:       i,
@@ -1859,6 +2102,8 @@ func main() {
 		return c.Send(msg, telebot.ModeHTML)
 	})
 
+	bot.Handle("/addquota", handleAddQuota)
+
 	bot.Handle("/addduration", func(c telebot.Context) error {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
@@ -1920,6 +2165,14 @@ func main() {
 			return c.Send("❌ Gagal memperbarui expire_time.")
 		}
 
+		// VIP sudah diubah; riwayat yang gagal cukup tercatat di log
+		_ = recordGrant(ctx, models.VIPGrant{
+			TelegramID: user.TelegramUserID,
+			Type:       models.GrantManual,
+			Days:       daysToAdd,
+			Note:       "/addduration",
+		})
+
 		if user.ExpireTime == nil {
 			return c.Send(fmt.Sprintf("✅ VIP user %s dihapus (habis masa aktif).", targetUserName))
 		}
@@ -1970,8 +2223,17 @@ func main() {
 	})
 	bot.SetCommands([]telebot.Command{
 		{Text: "start", Description: "Mulai bot"},
+		{Text: "katalog", Description: "Jelajahi katalog drama"},
+		{Text: "search", Description: "Cari drama"},
+		{Text: "lanjut", Description: "Lanjutkan drama yang sedang ditonton"},
+		{Text: "favorit", Description: "Drama yang kamu simpan"},
 		{Text: "vip", Description: "Langganan VIP"},
 		{Text: "status", Description: "Cek status akun"},
+		{Text: "history", Description: "Riwayat transaksi VIP"},
+		{Text: "pengingat", Description: "Atur pengingat masa aktif VIP"},
+		{Text: "batal", Description: "Batalkan input yang sedang berjalan"},
+		{Text: "referrals", Description: "Lihat hasil dan link referral kamu"},
+		{Text: "payout", Description: "Cairkan saldo bonus referral"},
 	})
 
 	http.HandleFunc("/webhook/pakasir", func(w http.ResponseWriter, r *http.Request) {
@@ -1988,6 +2250,10 @@ func main() {
 		bot.Start()
 	}()
 
+	go startPendingReconciler(jobsCtx, bot, 5*time.Minute)
+	go startReminderScheduler(jobsCtx, jobNotifier, 5*time.Minute)
+	go startExpirySweeper(jobsCtx, jobNotifier, time.Minute)
+
 	// Start HTTP server in goroutine
 	httpServer := &http.Server{
 		Addr:         ":8080",
@@ -2018,6 +2284,7 @@ func main() {
 	}
 
 	// Stop bot
+	stopJobs()
 	bot.Stop()
 
 	// Close MongoDB
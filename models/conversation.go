@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Conversation is the multi-step input a user is in the middle of: the bot
+// is waiting for their next text message to continue Flow. Data carries
+// whatever earlier steps collected.
+type Conversation struct {
+	TelegramID int64             `bson:"telegramID"`
+	Flow       string            `bson:"flow"`
+	Step       string            `bson:"step,omitempty"`
+	Data       map[string]string `bson:"data,omitempty"`
+	ExpiresAt  time.Time         `bson:"expires_at"` // dihapus otomatis oleh index TTL
+	UpdatedAt  time.Time         `bson:"updated_at"`
+}
@@ -1,12 +1,16 @@
 package models
 
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
 type Drama struct {
-	Id               string `bson:"id"`
-	Title            string `bson:"title"`
-	Slug             string `bson:"slug"`
-	TotalPart        int    `bson:"total_part"`
-	KeyWord          string `bson:"key_word, omitempty"`
-	Cast             string `bson:"cast, omitempty"`
-	Tag              string `bson:"tag, omitempty"`
-	TelegramSeriesID string `bson:"telegram_series_id"`
+	ID               primitive.ObjectID `bson:"_id,omitempty"`
+	Id               string             `bson:"id"`
+	Title            string             `bson:"title"`
+	Slug             string             `bson:"slug"`
+	TotalPart        int                `bson:"total_part"`
+	KeyWord          string             `bson:"key_word, omitempty"`
+	Cast             string             `bson:"cast, omitempty"`
+	Tag              string             `bson:"tag, omitempty"` // dipisah koma
+	Cover            string             `bson:"cover,omitempty"`
+	TelegramSeriesID string             `bson:"telegram_series_id"`
 }
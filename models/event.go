@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// VIPEvent types.
+const (
+	VIPEventExpired = "expired"
+)
+
+// VIPEvent records a change of a user's VIP status made by a background
+// job rather than by a purchase or grant.
+type VIPEvent struct {
+	TelegramID int64     `bson:"telegramID"`
+	Type       string    `bson:"type"`
+	ExpireTime time.Time `bson:"expire_time"`
+	CreatedAt  time.Time `bson:"created_at"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// Favorite is a drama a user saved with "❤️ Simpan". Saved dramas are listed
+// on /favorit and their new parts are announced to the user.
+type Favorite struct {
+	TelegramID int64     `bson:"telegramID"`
+	DramaSlug  string    `bson:"drama_slug"`
+	CreatedAt  time.Time `bson:"created_at"`
+}
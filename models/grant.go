@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// VIPGrant types.
+const (
+	GrantManual   = "manual"
+	GrantReferral = "referral"
+	GrantRevoked  = "revoked" // hari yang ditarik karena refund
+)
+
+// Notes of a GrantRevoked grant: which days the refund took back.
+const (
+	GrantNotePurchase = "purchase"
+	GrantNoteReferral = "refund" // juga semua catatan sebelum ada GrantNotePurchase
+)
+
+// VIPGrant records VIP days a user received outside their own purchase,
+// e.g. from the owner via /addduration or as a referral bonus.
+type VIPGrant struct {
+	TelegramID    int64     `bson:"telegramID"`
+	Type          string    `bson:"type"`
+	Days          int       `bson:"days"`
+	TransactionID string    `bson:"transactionID,omitempty"`
+	Note          string    `bson:"note,omitempty"`
+	CreatedAt     time.Time `bson:"created_at"`
+}
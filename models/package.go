@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// VIPPackage is a purchasable VIP package from the packages collection.
+type VIPPackage struct {
+	Code       string     `bson:"code"`
+	Label      string     `bson:"label"`
+	Price      int        `bson:"price"`
+	Days       int        `bson:"days"`
+	Active     bool       `bson:"active"`
+	PromoPrice int        `bson:"promo_price,omitempty"`
+	PromoStart *time.Time `bson:"promo_start,omitempty"`
+	PromoEnd   *time.Time `bson:"promo_end,omitempty"`
+	StarsPrice int        `bson:"stars_price,omitempty"` // harga Telegram Stars, 0 = dihitung dari Rupiah
+	CreatedAt  time.Time  `bson:"created_at"`
+	UpdatedAt  time.Time  `bson:"updated_at"`
+}
+
+// PromoActive reports whether the package's discount applies at t.
+func (p VIPPackage) PromoActive(t time.Time) bool {
+	if p.PromoPrice <= 0 || p.PromoStart == nil || p.PromoEnd == nil {
+		return false
+	}
+	return !t.Before(*p.PromoStart) && t.Before(*p.PromoEnd)
+}
+
+// PriceAt returns what the package costs at t, promo included.
+func (p VIPPackage) PriceAt(t time.Time) int {
+	if p.PromoActive(t) {
+		return p.PromoPrice
+	}
+	return p.Price
+}
+
+// StarsPriceAt returns the Telegram Stars price at t. Without an explicit
+// StarsPrice it is converted from the Rupiah price at idrPerStar; promos
+// discount both by the same ratio.
+func (p VIPPackage) StarsPriceAt(t time.Time, idrPerStar int) int {
+	if p.StarsPrice <= 0 {
+		return (p.PriceAt(t) + idrPerStar - 1) / idrPerStar
+	}
+	if p.PromoActive(t) && p.Price > 0 {
+		return (p.StarsPrice*p.PromoPrice + p.Price - 1) / p.Price
+	}
+	return p.StarsPrice
+}
@@ -0,0 +1,76 @@
+package models
+
+import "time"
+
+// ReferralPayoutRate is the Rupiah value of one referral bonus day when it
+// is cashed out (20% dari harga harian VIP).
+const ReferralPayoutRate = 400
+
+// Referral ledger entry types. Amounts are signed Rupiah.
+const (
+	LedgerBonus           = "bonus"            // bonus referral dari pembelian teman
+	LedgerBonusRevoked    = "bonus_revoked"    // pembelian teman direfund
+	LedgerPayoutRequested = "payout_requested" // saldo ditahan untuk pencairan
+	LedgerPayoutRejected  = "payout_rejected"  // saldo dikembalikan
+	LedgerPayoutApproved  = "payout_approved"  // dana sudah ditransfer
+)
+
+// ReferralLedgerEntry is one change to a user's referral balance. The
+// balance on the user is always the sum of their entries.
+type ReferralLedgerEntry struct {
+	TelegramID    int64     `bson:"telegramID"`
+	Type          string    `bson:"type"`
+	Amount        int       `bson:"amount"`
+	Days          int       `bson:"days,omitempty"`
+	TransactionID string    `bson:"transactionID,omitempty"`
+	PayoutID      string    `bson:"payoutID,omitempty"`
+	Balance       int       `bson:"balance"` // saldo setelah entri ini
+	Note          string    `bson:"note,omitempty"`
+	CreatedAt     time.Time `bson:"created_at"`
+}
+
+// Payout statuses.
+const (
+	PayoutPending  = "pending"
+	PayoutApproved = "approved"
+	PayoutRejected = "rejected"
+)
+
+// Payout is a user's request to cash out their referral balance.
+type Payout struct {
+	PayoutID   string     `bson:"payoutID"`
+	TelegramID int64      `bson:"telegramID"`
+	Amount     int        `bson:"amount"`
+	Wallet     string     `bson:"wallet"`
+	Number     string     `bson:"number"`
+	Status     string     `bson:"status"`
+	Note       string     `bson:"note,omitempty"`
+	CreatedAt  time.Time  `bson:"created_at"`
+	ResolvedAt *time.Time `bson:"resolved_at,omitempty"`
+}
+
+// Reasons a referral bonus is held for owner review.
+const (
+	ReferralFlagNewAccount  = "new_account"  // akun pembeli masih terlalu baru
+	ReferralFlagWeeklyCap   = "weekly_cap"   // bonus mingguan referrer sudah penuh
+	ReferralFlagSharedPayer = "shared_payer" // nama pembayar QRIS sama dengan referral lain
+	ReferralFlagCircular    = "circular"     // pembeli dan referrer saling mereferensikan
+)
+
+// Referral hold statuses.
+const (
+	ReferralHoldPending  = "pending"
+	ReferralHoldApproved = "approved"
+	ReferralHoldRejected = "rejected"
+)
+
+// ReferralHold records the referral bonuses of an activated transaction that
+// were withheld because the purchase looked like referral abuse.
+type ReferralHold struct {
+	Flags         []string   `bson:"flags"`
+	ReferrerID    int64      `bson:"referrerID,omitempty"`
+	PayerBonus    int        `bson:"payer_bonus"`
+	ReferrerBonus int        `bson:"referrer_bonus"`
+	Status        string     `bson:"status"`
+	ResolvedAt    *time.Time `bson:"resolved_at,omitempty"`
+}
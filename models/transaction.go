@@ -2,8 +2,122 @@ package models
 
 import "time"
 
-// TransactionPending represents pending VIP activation request
-// models/transaction_pending.go
+// TransactionState is a step in the lifecycle of a VIP purchase.
+type TransactionState string
+
+const (
+	StateCreated         TransactionState = "created"
+	StateAwaitingPayment TransactionState = "awaiting_payment"
+	StatePaid            TransactionState = "paid"
+	StateActivated       TransactionState = "activated"
+	StateCancelled       TransactionState = "cancelled"
+	StateExpired         TransactionState = "expired"
+	StateRefunded        TransactionState = "refunded"
+)
+
+// transactionTransitions lists, for every state, the states it may move to.
+// A payment can still arrive after cancellation or local expiry, so those
+// states may move to paid.
+var transactionTransitions = map[TransactionState][]TransactionState{
+	StateCreated:         {StateAwaitingPayment, StateCancelled, StateExpired},
+	StateAwaitingPayment: {StatePaid, StateCancelled, StateExpired},
+	StateCancelled:       {StatePaid},
+	StateExpired:         {StatePaid},
+	StatePaid:            {StateActivated, StateRefunded},
+	StateActivated:       {StateRefunded},
+}
+
+// CanTransition reports whether a transaction in state s may move to next.
+func (s TransactionState) CanTransition(next TransactionState) bool {
+	for _, allowed := range transactionTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// StatesBefore returns every state that may transition directly to next.
+func StatesBefore(next TransactionState) []TransactionState {
+	var states []TransactionState
+	for from, targets := range transactionTransitions {
+		for _, to := range targets {
+			if to == next {
+				states = append(states, from)
+			}
+		}
+	}
+	return states
+}
+
+// Review reasons for a paid transaction held for the owner instead of
+// being activated automatically.
+const (
+	ReviewPaidAfterCancel = "paid_after_cancel"
+	ReviewUnderpaid       = "underpaid"
+	ReviewOverpaid        = "overpaid"
+	ReviewActivationFail  = "activation_failed"
+)
+
+// Review resolutions.
+const (
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
+// StateChange is one timestamped entry in a transaction's history.
+type StateChange struct {
+	State TransactionState `bson:"state"`
+	At    time.Time        `bson:"at"`
+	Note  string           `bson:"note,omitempty"`
+}
+
+// ReferralPayout records VIP days credited to a referrer for a purchase.
+type ReferralPayout struct {
+	TelegramID int64  `bson:"telegramID"`
+	Code       string `bson:"code"`
+	Days       int    `bson:"days"`
+}
+
+const (
+	CurrencyIDR   = "IDR"
+	CurrencyStars = "XTR" // Telegram Stars
+)
+
+// Transaction is a single VIP purchase in the transactions ledger.
+type Transaction struct {
+	TransactionID    string           `bson:"transactionID"`
+	TelegramID       int64            `bson:"telegramID"`            // pembeli
+	RecipientID      int64            `bson:"recipientID,omitempty"` // penerima hadiah VIP
+	Provider         string           `bson:"provider"`
+	PackageCode      string           `bson:"package_code"`
+	Currency         string           `bson:"currency,omitempty"` // kosong = IDR
+	Amount           int              `bson:"amount"`
+	PaidAmount       int              `bson:"paid_amount,omitempty"`
+	Duration         int              `bson:"duration"`   // hari dari paket
+	BonusDays        int              `bson:"bonus_days"` // bonus referral untuk pembeli
+	ReferralCode     string           `bson:"referral_code,omitempty"`
+	ReferralPayouts  []ReferralPayout `bson:"referral_payouts,omitempty"`
+	ReferralHold     *ReferralHold    `bson:"referral_hold,omitempty"`
+	VoucherCode      string           `bson:"voucher_code,omitempty"`
+	Discount         int              `bson:"discount,omitempty"`           // potongan harga dari voucher
+	VoucherDays      int              `bson:"voucher_days,omitempty"`       // hari tambahan dari voucher
+	TelegramChargeID string           `bson:"telegram_charge_id,omitempty"` // pembayaran Telegram Stars
+	PayerName        string           `bson:"payer_name,omitempty"`         // nama pembayar QRIS dari gateway
+	State            TransactionState `bson:"state"`
+	History          []StateChange    `bson:"history"`
+	Review           string           `bson:"review,omitempty"`
+	ReviewResolution string           `bson:"review_resolution,omitempty"`
+	ActivationErrors int              `bson:"activation_errors,omitempty"` // percobaan aktivasi reconciler yang gagal
+	ExpiredAt        time.Time        `bson:"expired_at,omitempty"`
+	ActivatedAt      *time.Time       `bson:"activated_at,omitempty"`
+	RefundedAt       *time.Time       `bson:"refunded_at,omitempty"`
+	CreatedAt        time.Time        `bson:"created_at"`
+	UpdatedAt        time.Time        `bson:"updated_at"`
+}
+
+// TransactionPending represents pending VIP activation request.
+// Deprecated: kept to read records created before the transactions ledger.
 type TransactionPending struct {
 	TransactionID string    `bson:"transactionID"`
 	TelegramID    int64     `bson:"telegramID"`
@@ -13,7 +127,8 @@ type TransactionPending struct {
 	ReferralCode  string    `bson:"referral_code"`
 }
 
-// TransactionSuccess represents a completed/activated VIP
+// TransactionSuccess represents a completed/activated VIP.
+// Deprecated: kept to read records created before the transactions ledger.
 type TransactionSuccess struct {
 	TransactionID string    `bson:"transactionID"`
 	TelegramID    int64     `bson:"telegramID"`
@@ -0,0 +1,42 @@
+package models
+
+import "testing"
+
+func TestTransactionStateCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to TransactionState
+		want     bool
+	}{
+		{StateCreated, StateAwaitingPayment, true},
+		{StateCreated, StatePaid, false},
+		{StateAwaitingPayment, StatePaid, true},
+		// Pembayaran bisa tetap masuk setelah dibatalkan atau kedaluwarsa
+		{StateCancelled, StatePaid, true},
+		{StateExpired, StatePaid, true},
+		{StatePaid, StateActivated, true},
+		{StateActivated, StatePaid, false},
+		{StateActivated, StateRefunded, true},
+		{StateRefunded, StateActivated, false},
+		{StateActivated, StateActivated, false},
+	}
+	for _, tt := range tests {
+		if got := tt.from.CanTransition(tt.to); got != tt.want {
+			t.Errorf("%s -> %s = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestStatesBeforeMatchesCanTransition(t *testing.T) {
+	all := []TransactionState{StateCreated, StateAwaitingPayment, StatePaid, StateActivated, StateCancelled, StateExpired, StateRefunded}
+	for _, to := range all {
+		before := map[TransactionState]bool{}
+		for _, from := range StatesBefore(to) {
+			before[from] = true
+		}
+		for _, from := range all {
+			if before[from] != from.CanTransition(to) {
+				t.Errorf("StatesBefore(%s) has %s = %v, CanTransition says %v", to, from, before[from], from.CanTransition(to))
+			}
+		}
+	}
+}
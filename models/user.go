@@ -8,9 +8,28 @@ type User struct {
 	TelegramUserID   int64      `bson:"telegram_user_id"`
 	IsVIP            bool       `bson:"is_vip"`
 	ExpireTime       *time.Time `bson:"expire_time,omitempty"`
-	DailyLimit       int        `bson:"daily_limit"`
+	LapsedAt         *time.Time `bson:"lapsed_at,omitempty"` // expire_time terakhir yang sudah lewat
+	DailyLimit       int        `bson:"daily_limit"`         // lama, diganti QuotaDay/QuotaUsed
 	LastAccess       time.Time  `bson:"last_access"`
 	CreatedAt        time.Time  `bson:"created_at"`
+	QuotaDay         string     `bson:"quota_day,omitempty"`   // hari WIB (YYYY-MM-DD) milik QuotaUsed
+	QuotaUsed        int        `bson:"quota_used,omitempty"`  // part gratis yang ditonton pada QuotaDay
+	BonusQuota       int        `bson:"bonus_quota,omitempty"` // kuota tambahan, tidak direset harian
 	Code             string     `bson:"code"`
 	ReferralCode     string     `bson:"referral_code,omitempty"`
+	ReferralBalance  int        `bson:"referral_balance,omitempty"` // Rupiah, lihat ReferralLedgerEntry
+	StartSource      string     `bson:"start_source,omitempty"`     // kampanye dari payload src_ saat /start
+
+	// Pengingat masa aktif VIP. RemindedStage berlaku untuk expire_time
+	// yang sama dengan RemindedFor; perpanjangan otomatis mereset.
+	ReminderOptOut bool       `bson:"reminder_opt_out,omitempty"`
+	RemindedFor    *time.Time `bson:"reminded_for,omitempty"`
+	RemindedStage  int        `bson:"reminded_stage,omitempty"`
 }
+
+// Reminder stages, in the order they are sent.
+const (
+	ReminderNone = iota
+	Reminder24h
+	Reminder1h
+)
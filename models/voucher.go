@@ -0,0 +1,78 @@
+package models
+
+import "time"
+
+const (
+	VoucherPercent   = "percent"    // Value persen dari harga
+	VoucherFixed     = "fixed"      // Value Rupiah dari harga
+	VoucherBonusDays = "bonus_days" // Value hari tambahan, harga tetap
+)
+
+// Voucher is a promotion code redeemable at checkout.
+type Voucher struct {
+	Code         string    `bson:"code"`
+	Type         string    `bson:"type"`
+	Value        int       `bson:"value"`
+	MaxUses      int       `bson:"max_uses"`       // 0 = tanpa batas
+	PerUserLimit int       `bson:"per_user_limit"` // 0 = tanpa batas
+	Used         int       `bson:"used"`
+	Packages     []string  `bson:"packages,omitempty"` // kosong = semua paket
+	ExpiresAt    time.Time `bson:"expires_at"`
+	Active       bool      `bson:"active"`
+	CreatedAt    time.Time `bson:"created_at"`
+	UpdatedAt    time.Time `bson:"updated_at"`
+}
+
+// VoucherRedemption counts how many uses of a voucher one user holds. It
+// is unique per code and user, so the per-user limit can be enforced with
+// a single conditional upsert.
+type VoucherRedemption struct {
+	Code       string    `bson:"code"`
+	TelegramID int64     `bson:"telegramID"`
+	Used       int       `bson:"used"`
+	UpdatedAt  time.Time `bson:"updated_at"`
+}
+
+// Eligible reports whether the voucher can be used for the package code.
+func (v Voucher) Eligible(packageCode string) bool {
+	if len(v.Packages) == 0 {
+		return true
+	}
+	for _, code := range v.Packages {
+		if code == packageCode {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply returns the discounted price and the bonus days the voucher gives
+// on a package costing price. The price never drops below minPrice.
+func (v Voucher) Apply(price, minPrice int) (amount, bonusDays int) {
+	amount = price
+	switch v.Type {
+	case VoucherPercent:
+		amount = price - price*v.Value/100
+	case VoucherFixed:
+		amount = price - v.Value
+	case VoucherBonusDays:
+		bonusDays = v.Value
+	}
+	if amount < minPrice {
+		amount = minPrice
+	}
+	if amount > price {
+		amount = price
+	}
+	return amount, bonusDays
+}
+
+// ApplyStars is Apply for a price in Telegram Stars. A fixed voucher is
+// worth its Rupiah value, converted at idrPerStar Rupiah per Star and
+// rounded down so it never gives more than it says.
+func (v Voucher) ApplyStars(stars, idrPerStar, minStars int) (amount, bonusDays int) {
+	if v.Type == VoucherFixed {
+		v.Value /= idrPerStar
+	}
+	return v.Apply(stars, minStars)
+}
@@ -0,0 +1,51 @@
+package models
+
+import "testing"
+
+func TestVoucherApply(t *testing.T) {
+	tests := []struct {
+		name      string
+		v         Voucher
+		price     int
+		minPrice  int
+		amount    int
+		bonusDays int
+	}{
+		{"percent", Voucher{Type: VoucherPercent, Value: 10}, 15000, 1000, 13500, 0},
+		{"fixed", Voucher{Type: VoucherFixed, Value: 5000}, 15000, 1000, 10000, 0},
+		{"fixed above price", Voucher{Type: VoucherFixed, Value: 20000}, 15000, 1000, 1000, 0},
+		{"bonus days", Voucher{Type: VoucherBonusDays, Value: 3}, 15000, 1000, 15000, 3},
+		{"unknown type", Voucher{Type: "gratis", Value: 100}, 15000, 1000, 15000, 0},
+		// Harga di bawah minimum tidak dinaikkan oleh voucher
+		{"price below minimum", Voucher{Type: VoucherPercent, Value: 50}, 500, 1000, 500, 0},
+	}
+	for _, tt := range tests {
+		amount, bonusDays := tt.v.Apply(tt.price, tt.minPrice)
+		if amount != tt.amount || bonusDays != tt.bonusDays {
+			t.Errorf("%s: Apply(%d, %d) = %d, %d, want %d, %d", tt.name, tt.price, tt.minPrice, amount, bonusDays, tt.amount, tt.bonusDays)
+		}
+	}
+}
+
+func TestVoucherApplyStars(t *testing.T) {
+	tests := []struct {
+		name      string
+		v         Voucher
+		stars     int
+		amount    int
+		bonusDays int
+	}{
+		// Rp5.000 pada 250 Rupiah per Star = 20 Star, bukan 5.000 Star
+		{"fixed converted", Voucher{Type: VoucherFixed, Value: 5000}, 60, 40, 0},
+		{"fixed rounded down", Voucher{Type: VoucherFixed, Value: 1100}, 60, 56, 0},
+		{"fixed above price", Voucher{Type: VoucherFixed, Value: 50000}, 60, 1, 0},
+		{"percent", Voucher{Type: VoucherPercent, Value: 25}, 60, 45, 0},
+		{"bonus days", Voucher{Type: VoucherBonusDays, Value: 2}, 60, 60, 2},
+	}
+	for _, tt := range tests {
+		amount, bonusDays := tt.v.ApplyStars(tt.stars, 250, 1)
+		if amount != tt.amount || bonusDays != tt.bonusDays {
+			t.Errorf("%s: ApplyStars(%d) = %d, %d, want %d, %d", tt.name, tt.stars, amount, bonusDays, tt.amount, tt.bonusDays)
+		}
+	}
+}
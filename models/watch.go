@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// WatchProgress is how far a user got in one drama: the part they were last
+// sent, whether by the catalogue, a deep link or next/prev.
+type WatchProgress struct {
+	TelegramID int64     `bson:"telegramID"`
+	DramaSlug  string    `bson:"drama_slug"`
+	LastPart   int       `bson:"last_part"`
+	TotalPart  int       `bson:"total_part"`
+	CreatedAt  time.Time `bson:"created_at"`
+	UpdatedAt  time.Time `bson:"updated_at"`
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"gopkg.in/telebot.v3"
+)
+
+// broadcastRate keeps bulk sends under Telegram's ~30 messages per second
+// limit for bots.
+const broadcastRate = 25
+
+// notifier sends bulk messages from background jobs at a bounded rate so
+// they never starve the bot's interactive replies.
+type notifier struct {
+	bot  *telebot.Bot
+	tick <-chan time.Time
+}
+
+func newNotifier(bot *telebot.Bot, perSecond int) *notifier {
+	return &notifier{
+		bot:  bot,
+		tick: time.NewTicker(time.Second / time.Duration(perSecond)).C,
+	}
+}
+
+// send waits for its turn and delivers what to userID. It reports false when
+// the message could not be delivered, e.g. because the user blocked the bot.
+func (n *notifier) send(ctx context.Context, userID int64, what interface{}, opts ...interface{}) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-n.tick:
+	}
+
+	_, err := n.bot.Send(&telebot.User{ID: userID}, what, opts...)
+	if err == nil {
+		return true
+	}
+
+	var floodErr telebot.FloodError
+	if errors.As(err, &floodErr) {
+		log.Printf("⚠️ Flood limit hit, waiting %ds", floodErr.RetryAfter)
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(time.Duration(floodErr.RetryAfter) * time.Second):
+		}
+		_, err = n.bot.Send(&telebot.User{ID: userID}, what, opts...)
+		if err == nil {
+			return true
+		}
+	}
+	if !errors.Is(err, telebot.ErrBlockedByUser) && !errors.Is(err, telebot.ErrUserIsDeactivated) {
+		log.Printf("⚠️ Failed to notify %d: %v", userID, err)
+	}
+	return false
+}
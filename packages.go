@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"gopkg.in/telebot.v3"
+
+	"transferin-drama/database"
+	"transferin-drama/models"
+)
+
+// defaultPackages seeds an empty packages collection with the original prices.
+var defaultPackages = []models.VIPPackage{
+	{Code: "vip_1d", Label: "🎟️ VIP 1 Hari – Coba Dulu", Price: 2000, Days: 1, Active: true},
+	{Code: "vip_3d", Label: "🌟 VIP 3 Hari – Penonton Setia", Price: 4000, Days: 3, Active: true},
+	{Code: "vip_7d", Label: "🎬 VIP 7 Hari – Pecinta Drama", Price: 9000, Days: 7, Active: true},
+	{Code: "vip_30d", Label: "👑 VIP 30 Hari – Sultan Drama", Price: 25000, Days: 30, Active: true},
+}
+
+func seedPackages(ctx context.Context) error {
+	col := database.GetPackageCollection()
+
+	count, err := col.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	now := GetJakartaTime()
+	docs := make([]interface{}, 0, len(defaultPackages))
+	for _, pkg := range defaultPackages {
+		pkg.CreatedAt = now
+		pkg.UpdatedAt = now
+		docs = append(docs, pkg)
+	}
+	_, err = col.InsertMany(ctx, docs)
+	if err == nil {
+		log.Printf("✅ Seeded %d default VIP packages", len(docs))
+	}
+	return err
+}
+
+// getPackagesCatalogue returns packages ordered by duration. Inactive ones
+// are only included when all is true.
+func getPackagesCatalogue(ctx context.Context, all bool) ([]models.VIPPackage, error) {
+	filter := bson.M{"active": true}
+	if all {
+		filter = bson.M{}
+	}
+
+	cursor, err := database.GetPackageCollection().Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "days", Value: 1}, {Key: "price", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	var pkgs []models.VIPPackage
+	err = cursor.All(ctx, &pkgs)
+	return pkgs, err
+}
+
+func getPackage(ctx context.Context, code string) (*models.VIPPackage, error) {
+	var pkg models.VIPPackage
+	if err := database.GetPackageCollection().FindOne(ctx, bson.M{"code": code}).Decode(&pkg); err != nil {
+		return nil, err
+	}
+	return &pkg, nil
+}
+
+// packageButtonText renders a package for the /vip keyboard.
+func packageButtonText(pkg models.VIPPackage, now time.Time) string {
+	p := message.NewPrinter(language.Indonesian)
+	if pkg.PromoActive(now) {
+		return p.Sprintf("🔥 %s 💰Rp%d (dari Rp%d)", pkg.Label, pkg.PromoPrice, pkg.Price)
+	}
+	return p.Sprintf("%s 💰Rp%d", pkg.Label, pkg.Price)
+}
+
+// handlePackageAdmin lets the owner manage the VIP catalogue:
+//
+//	/package
+//	/package add <code> <harga> <hari> <label...>
+//	/package disable|enable <code>
+//	/package promo <code> <harga> <jam>
+//	/package promo <code> off
+//	/package stars <code> <bintang|auto>
+func handlePackageAdmin(c telebot.Context) error {
+	ownerID := os.Getenv("BOT_OWNER_ID")
+	if fmt.Sprint(c.Sender().ID) != ownerID {
+		return c.Send("❌ Kamu tidak punya akses ke perintah ini.")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	args := c.Args()
+	usage := "⚠️ Format salah!\n" +
+		"<code>/package</code>\n" +
+		"<code>/package add vip_14d 15000 14 💎 VIP 14 Hari</code>\n" +
+		"<code>/package disable vip_14d</code>\n" +
+		"<code>/package enable vip_14d</code>\n" +
+		"<code>/package promo vip_7d 7000 24</code>\n" +
+		"<code>/package promo vip_7d off</code>\n" +
+		"<code>/package stars vip_7d 40</code>\n" +
+		"<code>/package stars vip_7d auto</code>"
+
+	if len(args) == 0 || args[0] == "list" {
+		return c.Send(listPackagesText(ctx), telebot.ModeHTML)
+	}
+
+	col := database.GetPackageCollection()
+	now := GetJakartaTime()
+
+	switch args[0] {
+	case "add":
+		if len(args) < 5 {
+			return c.Send(usage, telebot.ModeHTML)
+		}
+		price, err := strconv.Atoi(args[2])
+		if err != nil || price <= 0 {
+			return c.Send("⚠️ Harga tidak valid.")
+		}
+		days, err := strconv.Atoi(args[3])
+		if err != nil || days <= 0 {
+			return c.Send("⚠️ Jumlah hari tidak valid.")
+		}
+		code := args[1]
+		label := strings.Join(args[4:], " ")
+
+		_, err = col.UpdateOne(ctx,
+			bson.M{"code": code},
+			bson.M{
+				"$set": bson.M{
+					"label":      label,
+					"price":      price,
+					"days":       days,
+					"active":     true,
+					"updated_at": now,
+				},
+				"$setOnInsert": bson.M{"code": code, "created_at": now},
+			},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			log.Println("❌ Gagal menyimpan paket:", err)
+			return c.Send("❌ Gagal menyimpan paket.")
+		}
+		return c.Send(fmt.Sprintf("✅ Paket <code>%s</code> disimpan.\n\n%s", code, listPackagesText(ctx)), telebot.ModeHTML)
+
+	case "disable", "enable":
+		if len(args) != 2 {
+			return c.Send(usage, telebot.ModeHTML)
+		}
+		res, err := col.UpdateOne(ctx,
+			bson.M{"code": args[1]},
+			bson.M{"$set": bson.M{"active": args[0] == "enable", "updated_at": now}},
+		)
+		if err != nil {
+			return c.Send("❌ Gagal memperbarui paket.")
+		}
+		if res.MatchedCount == 0 {
+			return c.Send("❌ Paket tidak ditemukan.")
+		}
+		return c.Send(listPackagesText(ctx), telebot.ModeHTML)
+
+	case "promo":
+		if len(args) == 3 && args[2] == "off" {
+			res, err := col.UpdateOne(ctx,
+				bson.M{"code": args[1]},
+				bson.M{
+					"$unset": bson.M{"promo_price": "", "promo_start": "", "promo_end": ""},
+					"$set":   bson.M{"updated_at": now},
+				},
+			)
+			if err != nil {
+				return c.Send("❌ Gagal memperbarui paket.")
+			}
+			if res.MatchedCount == 0 {
+				return c.Send("❌ Paket tidak ditemukan.")
+			}
+			return c.Send(listPackagesText(ctx), telebot.ModeHTML)
+		}
+		if len(args) != 4 {
+			return c.Send(usage, telebot.ModeHTML)
+		}
+		promoPrice, err := strconv.Atoi(args[2])
+		if err != nil || promoPrice <= 0 {
+			return c.Send("⚠️ Harga promo tidak valid.")
+		}
+		hours, err := strconv.Atoi(args[3])
+		if err != nil || hours <= 0 {
+			return c.Send("⚠️ Durasi promo (jam) tidak valid.")
+		}
+		pkg, err := getPackage(ctx, args[1])
+		if err != nil {
+			return c.Send("❌ Paket tidak ditemukan.")
+		}
+		// Label "dari Rp..." hanya jujur kalau promo memang lebih murah
+		if promoPrice >= pkg.Price {
+			return c.Send(message.NewPrinter(language.Indonesian).Sprintf("⚠️ Harga promo harus lebih murah dari harga normal (Rp %d).", pkg.Price))
+		}
+		promoEnd := now.Add(time.Duration(hours) * time.Hour)
+		res, err := col.UpdateOne(ctx,
+			bson.M{"code": args[1], "price": bson.M{"$gt": promoPrice}},
+			bson.M{"$set": bson.M{
+				"promo_price": promoPrice,
+				"promo_start": now,
+				"promo_end":   promoEnd,
+				"updated_at":  now,
+			}},
+		)
+		if err != nil {
+			return c.Send("❌ Gagal memperbarui paket.")
+		}
+		if res.MatchedCount == 0 {
+			return c.Send("❌ Paket tidak ditemukan.")
+		}
+		return c.Send(listPackagesText(ctx), telebot.ModeHTML)
+
+	case "stars":
+		if len(args) != 3 {
+			return c.Send(usage, telebot.ModeHTML)
+		}
+		update := bson.M{"$unset": bson.M{"stars_price": ""}, "$set": bson.M{"updated_at": now}}
+		if args[2] != "auto" {
+			stars, err := strconv.Atoi(args[2])
+			if err != nil || stars <= 0 {
+				return c.Send("⚠️ Harga Stars tidak valid.")
+			}
+			update = bson.M{"$set": bson.M{"stars_price": stars, "updated_at": now}}
+		}
+		res, err := col.UpdateOne(ctx, bson.M{"code": args[1]}, update)
+		if err != nil {
+			return c.Send("❌ Gagal memperbarui paket.")
+		}
+		if res.MatchedCount == 0 {
+			return c.Send("❌ Paket tidak ditemukan.")
+		}
+		return c.Send(listPackagesText(ctx), telebot.ModeHTML)
+	}
+
+	return c.Send(usage, telebot.ModeHTML)
+}
+
+func listPackagesText(ctx context.Context) string {
+	pkgs, err := getPackagesCatalogue(ctx, true)
+	if err != nil {
+		log.Println("❌ Gagal mengambil paket:", err)
+		return "❌ Gagal mengambil daftar paket."
+	}
+
+	p := message.NewPrinter(language.Indonesian)
+	now := GetJakartaTime()
+
+	var msg strings.Builder
+	msg.WriteString("📦 <b>Daftar Paket VIP</b>\n\n")
+	for _, pkg := range pkgs {
+		status := "✅"
+		if !pkg.Active {
+			status = "🚫"
+		}
+		msg.WriteString(p.Sprintf("%s <code>%s</code> — %s\n    %d hari • Rp %d • %d ⭐", status, pkg.Code, pkg.Label, pkg.Days, pkg.Price, pkg.StarsPriceAt(now, starsIDRRate())))
+		if pkg.PromoActive(now) {
+			msg.WriteString(p.Sprintf(" • 🔥 Promo Rp %d s/d %s", pkg.PromoPrice, pkg.PromoEnd.Format("02-01-2006 15:04")))
+		}
+		msg.WriteString("\n")
+	}
+	if len(pkgs) == 0 {
+		msg.WriteString("Belum ada paket.")
+	}
+	return msg.String()
+}
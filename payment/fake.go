@@ -0,0 +1,140 @@
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// FakeProvider is an in-memory PaymentProvider for tests and local runs.
+// Invoices only become paid when MarkPaid is called.
+type FakeProvider struct {
+	mu       sync.Mutex
+	invoices map[string]*TransactionStatus
+	TTL      time.Duration
+}
+
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{
+		invoices: make(map[string]*TransactionStatus),
+		TTL:      15 * time.Minute,
+	}
+}
+
+func (f *FakeProvider) Name() string {
+	return "fake"
+}
+
+func (f *FakeProvider) CreateInvoice(ctx context.Context, orderID string, amount int) (*Invoice, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, exists := f.invoices[orderID]; exists {
+		return nil, fmt.Errorf("payment: duplicate order %s", orderID)
+	}
+	f.invoices[orderID] = &TransactionStatus{
+		OrderID:       orderID,
+		Amount:        amount,
+		Status:        StatusPending,
+		PaymentMethod: "qris",
+	}
+
+	return &Invoice{
+		OrderID:       orderID,
+		Amount:        amount,
+		PaymentNumber: "FAKEQRIS-" + orderID,
+		ExpiredAt:     time.Now().Add(f.TTL),
+	}, nil
+}
+
+func (f *FakeProvider) CancelInvoice(ctx context.Context, orderID string, amount int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	inv, ok := f.invoices[orderID]
+	if !ok {
+		return ErrUnknownOrder
+	}
+	if inv.Status == StatusCompleted {
+		return fmt.Errorf("payment: order %s already paid", orderID)
+	}
+	inv.Status = StatusCancelled
+	return nil
+}
+
+func (f *FakeProvider) QueryStatus(ctx context.Context, orderID string, amount int) (*TransactionStatus, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	inv, ok := f.invoices[orderID]
+	if !ok {
+		return nil, ErrUnknownOrder
+	}
+	status := *inv
+	return &status, nil
+}
+
+// ParseWebhook accepts the same JSON body as Pakasir so tests can replay
+// real notifications.
+func (f *FakeProvider) ParseWebhook(r *http.Request) (*WebhookEvent, error) {
+	var payload pakasirWebhook
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return nil, err
+	}
+	if payload.OrderID == "" {
+		return nil, fmt.Errorf("payment: webhook without order_id")
+	}
+
+	return &WebhookEvent{
+		OrderID:       payload.OrderID,
+		Amount:        payload.Amount,
+		Status:        pakasirStatus(payload.Status),
+		PaymentMethod: payload.PaymentMethod,
+		PayerName:     payload.PayerName,
+	}, nil
+}
+
+// MarkPaid simulates the customer paying an invoice.
+func (f *FakeProvider) MarkPaid(orderID string) error {
+	return f.MarkPaidAmount(orderID, 0)
+}
+
+// MarkPaidAmount simulates the customer paying amount instead of the
+// invoiced amount, e.g. to test under- and overpayment. Zero pays the
+// invoice exactly.
+func (f *FakeProvider) MarkPaidAmount(orderID string, amount int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	inv, ok := f.invoices[orderID]
+	if !ok {
+		return ErrUnknownOrder
+	}
+	if inv.Status != StatusPending {
+		return fmt.Errorf("payment: order %s is %s", orderID, inv.Status)
+	}
+	if amount > 0 {
+		inv.Amount = amount
+	}
+	inv.Status = StatusCompleted
+	inv.CompletedAt = time.Now()
+	return nil
+}
+
+func (f *FakeProvider) Refund(ctx context.Context, orderID string, amount int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	inv, ok := f.invoices[orderID]
+	if !ok {
+		return ErrUnknownOrder
+	}
+	if inv.Status != StatusCompleted {
+		return fmt.Errorf("payment: order %s is %s", orderID, inv.Status)
+	}
+	inv.Status = StatusRefunded
+	return nil
+}
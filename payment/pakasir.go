@@ -0,0 +1,225 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Pakasir talks to the Pakasir QRIS gateway.
+type Pakasir struct {
+	BaseURL   string
+	CreateURL string
+	Project   string
+	APIKey    string
+	Client    *http.Client
+}
+
+type pakasirCreateResponse struct {
+	Payment struct {
+		PaymentNumber string `json:"payment_number"`
+		ExpiredAt     string `json:"expired_at"`
+	} `json:"payment"`
+}
+
+type pakasirCancelResponse struct {
+	Success bool `json:"success"`
+}
+
+type pakasirDetailResponse struct {
+	Transaction struct {
+		Amount        int    `json:"amount"`
+		OrderID       string `json:"order_id"`
+		Project       string `json:"project"`
+		Status        string `json:"status"`
+		PaymentMethod string `json:"payment_method"`
+		PayerName     string `json:"payer_name"`
+		CompletedAt   string `json:"completed_at"`
+	} `json:"transaction"`
+}
+
+type pakasirWebhook struct {
+	Amount        int    `json:"amount"`
+	OrderID       string `json:"order_id"`
+	Project       string `json:"project"`
+	Status        string `json:"status"`
+	PaymentMethod string `json:"payment_method"`
+	PayerName     string `json:"payer_name"`
+	CompletedAt   string `json:"completed_at"`
+}
+
+// NewPakasir builds the provider from PG_URL, PAKASIR_BASE_URL,
+// PAKASIR_PROJECT and PAKASIR_API_KEY.
+func NewPakasir() *Pakasir {
+	baseURL := os.Getenv("PAKASIR_BASE_URL")
+	if baseURL == "" {
+		baseURL = "https://app.pakasir.com"
+	}
+	createURL := os.Getenv("PG_URL")
+	if createURL == "" {
+		createURL = baseURL + "/api/transactioncreate/qris"
+	}
+	project := os.Getenv("PAKASIR_PROJECT")
+	if project == "" {
+		project = "drama-trans"
+	}
+
+	return &Pakasir{
+		BaseURL:   baseURL,
+		CreateURL: createURL,
+		Project:   project,
+		APIKey:    os.Getenv("PAKASIR_API_KEY"),
+		Client:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (p *Pakasir) Name() string {
+	return "pakasir"
+}
+
+func (p *Pakasir) CreateInvoice(ctx context.Context, orderID string, amount int) (*Invoice, error) {
+	var results pakasirCreateResponse
+	if err := p.post(ctx, p.CreateURL, orderID, amount, &results); err != nil {
+		return nil, err
+	}
+
+	if results.Payment.PaymentNumber == "" || results.Payment.ExpiredAt == "" {
+		return nil, fmt.Errorf("payment: incomplete create response for %s", orderID)
+	}
+
+	expiredAt, err := time.Parse(time.RFC3339Nano, results.Payment.ExpiredAt)
+	if err != nil {
+		return nil, fmt.Errorf("payment: parse expired_at: %w", err)
+	}
+
+	return &Invoice{
+		OrderID:       orderID,
+		Amount:        amount,
+		PaymentNumber: results.Payment.PaymentNumber,
+		ExpiredAt:     expiredAt,
+	}, nil
+}
+
+func (p *Pakasir) CancelInvoice(ctx context.Context, orderID string, amount int) error {
+	var results pakasirCancelResponse
+	if err := p.post(ctx, p.BaseURL+"/api/transactioncancel", orderID, amount, &results); err != nil {
+		return err
+	}
+	if !results.Success {
+		return fmt.Errorf("payment: gateway refused to cancel %s", orderID)
+	}
+	return nil
+}
+
+func (p *Pakasir) QueryStatus(ctx context.Context, orderID string, amount int) (*TransactionStatus, error) {
+	q := url.Values{}
+	q.Set("project", p.Project)
+	q.Set("amount", strconv.Itoa(amount))
+	q.Set("order_id", orderID)
+	q.Set("api_key", p.APIKey)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.BaseURL+"/api/transactiondetail?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrUnknownOrder
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("payment: transaction detail returned %s", resp.Status)
+	}
+
+	var detail pakasirDetailResponse
+	if err := json.NewDecoder(resp.Body).Decode(&detail); err != nil {
+		return nil, err
+	}
+
+	status := &TransactionStatus{
+		OrderID:       detail.Transaction.OrderID,
+		Amount:        detail.Transaction.Amount,
+		Status:        pakasirStatus(detail.Transaction.Status),
+		PaymentMethod: detail.Transaction.PaymentMethod,
+		PayerName:     detail.Transaction.PayerName,
+	}
+	if t, err := time.Parse(time.RFC3339Nano, detail.Transaction.CompletedAt); err == nil {
+		status.CompletedAt = t
+	}
+	return status, nil
+}
+
+func (p *Pakasir) ParseWebhook(r *http.Request) (*WebhookEvent, error) {
+	var payload pakasirWebhook
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return nil, err
+	}
+	if payload.OrderID == "" {
+		return nil, fmt.Errorf("payment: webhook without order_id")
+	}
+	if payload.Project != "" && payload.Project != p.Project {
+		return nil, fmt.Errorf("payment: webhook for foreign project %q", payload.Project)
+	}
+
+	return &WebhookEvent{
+		OrderID:       payload.OrderID,
+		Amount:        payload.Amount,
+		Status:        pakasirStatus(payload.Status),
+		PaymentMethod: payload.PaymentMethod,
+		PayerName:     payload.PayerName,
+	}, nil
+}
+
+func (p *Pakasir) post(ctx context.Context, endpoint, orderID string, amount int, out interface{}) error {
+	payload := map[string]interface{}{
+		"project":  p.Project,
+		"order_id": orderID,
+		"amount":   amount,
+		"api_key":  p.APIKey,
+	}
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewBuffer(jsonPayload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("payment: %s returned %s", endpoint, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func pakasirStatus(s string) Status {
+	switch s {
+	case "completed":
+		return StatusCompleted
+	case "canceled", "cancelled":
+		return StatusCancelled
+	case "expired":
+		return StatusExpired
+	default:
+		return StatusPending
+	}
+}
@@ -0,0 +1,69 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+var (
+	// ErrNotPaid is returned when the gateway does not report the order as completed.
+	ErrNotPaid = errors.New("payment: transaction is not completed at gateway")
+	// ErrUnknownOrder is returned when the provider has no record of an order.
+	ErrUnknownOrder = errors.New("payment: unknown order")
+)
+
+// Status is the provider-neutral state of an invoice.
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusCompleted Status = "completed"
+	StatusCancelled Status = "cancelled"
+	StatusExpired   Status = "expired"
+	StatusRefunded  Status = "refunded"
+)
+
+// Invoice is a payable QRIS invoice created at the gateway.
+type Invoice struct {
+	OrderID       string
+	Amount        int
+	PaymentNumber string // raw QRIS string, rendered into the QR image
+	ExpiredAt     time.Time
+}
+
+// TransactionStatus is what the gateway currently reports for an order.
+type TransactionStatus struct {
+	OrderID       string
+	Amount        int
+	Status        Status
+	PaymentMethod string
+	PayerName     string // nama pemilik rekening/e-wallet, jika dilaporkan
+	CompletedAt   time.Time
+}
+
+// WebhookEvent is an incoming payment notification, normalised so the VIP
+// activation logic does not depend on a provider's payload format.
+type WebhookEvent struct {
+	OrderID       string
+	Amount        int
+	Status        Status
+	PaymentMethod string
+	PayerName     string
+}
+
+// PaymentProvider is implemented by every QRIS gateway the bot can use.
+type PaymentProvider interface {
+	Name() string
+	CreateInvoice(ctx context.Context, orderID string, amount int) (*Invoice, error)
+	CancelInvoice(ctx context.Context, orderID string, amount int) error
+	QueryStatus(ctx context.Context, orderID string, amount int) (*TransactionStatus, error)
+	ParseWebhook(r *http.Request) (*WebhookEvent, error)
+}
+
+// Refunder is implemented by providers that can return a completed payment
+// through their API. Payments at other providers are refunded by hand.
+type Refunder interface {
+	Refund(ctx context.Context, orderID string, amount int) error
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"gopkg.in/telebot.v3"
+
+	"transferin-drama/database"
+	"transferin-drama/models"
+	"transferin-drama/payment"
+)
+
+// openFakeInvoice returns an awaiting_payment transaction with an invoice at
+// fake, without touching the database.
+func openFakeInvoice(t *testing.T, fake *payment.FakeProvider, transactionID string, amount int) *models.Transaction {
+	t.Helper()
+
+	if _, err := fake.CreateInvoice(context.Background(), transactionID, amount); err != nil {
+		t.Fatalf("create invoice: %v", err)
+	}
+	return &models.Transaction{
+		TransactionID: transactionID,
+		State:         models.StateAwaitingPayment,
+		Amount:        amount,
+		Duration:      7,
+	}
+}
+
+func TestQueryPaidAmount(t *testing.T) {
+	ctx := context.Background()
+	fake := payment.NewFakeProvider()
+
+	paid := openFakeInvoice(t, fake, "TRX-PAID", 15000)
+	if err := fake.MarkPaid(paid.TransactionID); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := queryPaidAmount(ctx, fake, paid); err != nil || got != 15000 {
+		t.Errorf("paid invoice: got %d, %v; want 15000, nil", got, err)
+	}
+
+	// Nominal yang dipakai adalah yang dilaporkan gateway
+	short := openFakeInvoice(t, fake, "TRX-SHORT", 15000)
+	if err := fake.MarkPaidAmount(short.TransactionID, 10000); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := queryPaidAmount(ctx, fake, short); err != nil || got != 10000 {
+		t.Errorf("underpaid invoice: got %d, %v; want 10000, nil", got, err)
+	}
+
+	pending := openFakeInvoice(t, fake, "TRX-PENDING", 15000)
+	if _, err := queryPaidAmount(ctx, fake, pending); !errors.Is(err, payment.ErrNotPaid) {
+		t.Errorf("pending invoice: err = %v, want ErrNotPaid", err)
+	}
+
+	cancelled := openFakeInvoice(t, fake, "TRX-CANCELLED", 15000)
+	if err := fake.CancelInvoice(ctx, cancelled.TransactionID, cancelled.Amount); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := queryPaidAmount(ctx, fake, cancelled); !errors.Is(err, payment.ErrNotPaid) {
+		t.Errorf("cancelled invoice: err = %v, want ErrNotPaid", err)
+	}
+
+	unknown := &models.Transaction{TransactionID: "TRX-UNKNOWN", Amount: 15000}
+	if _, err := queryPaidAmount(ctx, fake, unknown); !errors.Is(err, payment.ErrUnknownOrder) {
+		t.Errorf("unknown order: err = %v, want ErrUnknownOrder", err)
+	}
+}
+
+func TestPaymentReviewReason(t *testing.T) {
+	tests := []struct {
+		name  string
+		state models.TransactionState
+		paid  int
+		want  string
+	}{
+		{"exact", models.StateAwaitingPayment, 15000, ""},
+		{"underpaid", models.StateAwaitingPayment, 10000, models.ReviewUnderpaid},
+		{"overpaid", models.StateAwaitingPayment, 20000, models.ReviewOverpaid},
+		{"paid after cancel", models.StateCancelled, 15000, models.ReviewPaidAfterCancel},
+		// Pembatalan lebih penting daripada selisih nominal
+		{"underpaid after cancel", models.StateCancelled, 10000, models.ReviewPaidAfterCancel},
+	}
+	for _, tt := range tests {
+		tx := &models.Transaction{State: tt.state, Amount: 15000}
+		if got := paymentReviewReason(tx, tt.paid); got != tt.want {
+			t.Errorf("%s: paymentReviewReason = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// paymentTestEnv wires the payment path to a FakeProvider behind an httptest
+// gateway, a stub Telegram API and a throwaway database.
+type paymentTestEnv struct {
+	fake    *payment.FakeProvider
+	gateway *httptest.Server
+}
+
+// newPaymentTestEnv needs a MongoDB replica set (activation runs in a
+// transaction), given as TEST_MONGO_URI; without it the test is skipped.
+// The verification decision itself is covered above without a database.
+func newPaymentTestEnv(t *testing.T) *paymentTestEnv {
+	t.Helper()
+
+	uri := os.Getenv("TEST_MONGO_URI")
+	if uri == "" {
+		t.Skip("TEST_MONGO_URI not set; skipping payment flow test")
+	}
+	if err := database.Connect(uri, fmt.Sprintf("dramatrans_test_%d", time.Now().UnixNano())); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = database.GetDatabase().Drop(context.Background())
+		_ = database.Disconnect()
+	})
+	if err := database.EnsureIndexes(context.Background()); err != nil {
+		t.Fatalf("indexes: %v", err)
+	}
+
+	// Semua panggilan Bot API dijawab sukses
+	telegram := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"ok":true,"result":{"message_id":1,"date":0,"chat":{"id":1,"type":"private"}}}`)
+	}))
+	t.Cleanup(telegram.Close)
+
+	bot, err := telebot.NewBot(telebot.Settings{Token: "test", URL: telegram.URL, Offline: true})
+	if err != nil {
+		t.Fatalf("bot: %v", err)
+	}
+
+	fake := payment.NewFakeProvider()
+	previous := paymentProvider
+	paymentProvider = fake
+	t.Cleanup(func() { paymentProvider = previous })
+
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleWebhook(w, r, bot)
+	}))
+	t.Cleanup(gateway.Close)
+
+	return &paymentTestEnv{fake: fake, gateway: gateway}
+}
+
+// openInvoice creates a user and an awaiting_payment transaction with an
+// invoice at the fake gateway, as sendQris does.
+func (e *paymentTestEnv) openInvoice(t *testing.T, telegramID int64, amount, days int) string {
+	t.Helper()
+	ctx := context.Background()
+
+	_, err := database.GetUserCollection().InsertOne(ctx, models.User{
+		TelegramUserID: telegramID,
+		TelegramName:   "Budi Santoso",
+		CreatedAt:      GetJakartaTime().Add(-72 * time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+
+	transactionID := generateTransactionID()
+	tx := &models.Transaction{
+		TransactionID: transactionID,
+		TelegramID:    telegramID,
+		Provider:      e.fake.Name(),
+		PackageCode:   "vip_7d",
+		Amount:        amount,
+		Duration:      days,
+	}
+	if err := createTransaction(ctx, tx); err != nil {
+		t.Fatalf("create transaction: %v", err)
+	}
+	invoice, err := e.fake.CreateInvoice(ctx, transactionID, amount)
+	if err != nil {
+		t.Fatalf("create invoice: %v", err)
+	}
+	if _, err := transitionTransaction(ctx, transactionID, models.StateAwaitingPayment, "", bson.M{"expired_at": invoice.ExpiredAt}); err != nil {
+		t.Fatalf("await payment: %v", err)
+	}
+	return transactionID
+}
+
+// sendWebhook posts a Pakasir-style "completed" notification to the gateway.
+func (e *paymentTestEnv) sendWebhook(t *testing.T, transactionID string, amount int) {
+	t.Helper()
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"order_id":       transactionID,
+		"amount":         amount,
+		"status":         "completed",
+		"payment_method": "qris",
+	})
+	resp, err := http.Post(e.gateway.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("webhook: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("webhook status = %d", resp.StatusCode)
+	}
+}
+
+// waitForState polls until the webhook, handled in the background, has
+// moved the transaction to state.
+func waitForState(t *testing.T, transactionID string, state models.TransactionState) *models.Transaction {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		tx, err := getTransaction(context.Background(), transactionID)
+		if err == nil && tx.State == state {
+			return tx
+		}
+		if time.Now().After(deadline) {
+			got := models.TransactionState("")
+			if tx != nil {
+				got = tx.State
+			}
+			t.Fatalf("transaction %s is %q, want %q", transactionID, got, state)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func getTestUser(t *testing.T, telegramID int64) models.User {
+	t.Helper()
+
+	var u models.User
+	if err := database.GetUserCollection().FindOne(context.Background(), bson.M{"telegram_user_id": telegramID}).Decode(&u); err != nil {
+		t.Fatalf("load user: %v", err)
+	}
+	return u
+}
+
+func TestWebhookPaidActivatesVIP(t *testing.T) {
+	env := newPaymentTestEnv(t)
+	const userID = 1001
+
+	transactionID := env.openInvoice(t, userID, 15000, 7)
+	if err := env.fake.MarkPaid(transactionID); err != nil {
+		t.Fatal(err)
+	}
+	env.sendWebhook(t, transactionID, 15000)
+
+	tx := waitForState(t, transactionID, models.StateActivated)
+	if tx.PaidAmount != 15000 {
+		t.Errorf("paid_amount = %d, want 15000", tx.PaidAmount)
+	}
+	var states []models.TransactionState
+	for _, h := range tx.History {
+		states = append(states, h.State)
+	}
+	want := []models.TransactionState{models.StateCreated, models.StateAwaitingPayment, models.StatePaid, models.StateActivated}
+	if fmt.Sprint(states) != fmt.Sprint(want) {
+		t.Errorf("history = %v, want %v", states, want)
+	}
+
+	u := getTestUser(t, userID)
+	if !u.IsVIP || u.ExpireTime == nil {
+		t.Fatalf("user is_vip = %v, expire_time = %v, want VIP", u.IsVIP, u.ExpireTime)
+	}
+	if left := time.Until(*u.ExpireTime); left < 6*24*time.Hour || left > 8*24*time.Hour {
+		t.Errorf("VIP left = %s, want about 7 days", left)
+	}
+
+	// Webhook yang sama dikirim ulang tidak memperpanjang lagi
+	expire := *u.ExpireTime
+	env.sendWebhook(t, transactionID, 15000)
+	time.Sleep(300 * time.Millisecond)
+	if u := getTestUser(t, userID); !u.ExpireTime.Equal(expire) {
+		t.Errorf("replayed webhook moved expire_time from %s to %s", expire, u.ExpireTime)
+	}
+}
+
+func TestWebhookUnderpaidGoesToReview(t *testing.T) {
+	env := newPaymentTestEnv(t)
+	const userID = 1002
+
+	transactionID := env.openInvoice(t, userID, 15000, 7)
+	if err := env.fake.MarkPaidAmount(transactionID, 10000); err != nil {
+		t.Fatal(err)
+	}
+	// Nominal di webhook diabaikan; yang dipakai jawaban gateway
+	env.sendWebhook(t, transactionID, 15000)
+
+	tx := waitForState(t, transactionID, models.StatePaid)
+	if tx.Review != models.ReviewUnderpaid {
+		t.Errorf("review = %q, want %q", tx.Review, models.ReviewUnderpaid)
+	}
+	if tx.PaidAmount != 10000 {
+		t.Errorf("paid_amount = %d, want 10000", tx.PaidAmount)
+	}
+	if u := getTestUser(t, userID); u.IsVIP {
+		t.Error("underpaid transaction granted VIP")
+	}
+}
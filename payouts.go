@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"gopkg.in/telebot.v3"
+
+	"transferin-drama/database"
+	"transferin-drama/models"
+)
+
+// minPayoutAmount is the smallest referral balance that can be cashed out.
+const minPayoutAmount = 10000
+
+var (
+	errInsufficientBalance = errors.New("insufficient referral balance")
+	errPayoutPending       = errors.New("payout already pending")
+)
+
+var payoutWallets = map[string]string{
+	"dana":      "DANA",
+	"ovo":       "OVO",
+	"gopay":     "GoPay",
+	"shopeepay": "ShopeePay",
+}
+
+var payoutNumberPattern = regexp.MustCompile(`^08[0-9]{8,12}$`)
+
+// adjustReferralBalance changes a user's referral balance by entry.Amount and
+// appends the entry to the referral ledger. A debit fails with
+// errInsufficientBalance instead of going below zero when requireFunds is
+// set. It must run inside sc.
+func adjustReferralBalance(sc mongo.SessionContext, entry models.ReferralLedgerEntry, requireFunds bool) error {
+	filter := bson.M{"telegram_user_id": entry.TelegramID}
+	if requireFunds && entry.Amount < 0 {
+		filter["referral_balance"] = bson.M{"$gte": -entry.Amount}
+	}
+
+	var u models.User
+	err := database.GetUserCollection().FindOneAndUpdate(sc, filter,
+		bson.M{"$inc": bson.M{"referral_balance": entry.Amount}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&u)
+	if err == mongo.ErrNoDocuments {
+		return errInsufficientBalance
+	}
+	if err != nil {
+		return err
+	}
+
+	entry.Balance = u.ReferralBalance
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = GetJakartaTime()
+	}
+	_, err = database.GetReferralLedgerCollection().InsertOne(sc, entry)
+	return err
+}
+
+func generatePayoutID() string {
+	randomBytes := make([]byte, 3)
+	rand.Read(randomBytes)
+	return fmt.Sprintf("PO-%s-%s", time.Now().Format("20060102150405"), hex.EncodeToString(randomBytes))
+}
+
+// handlePayout shows the referral balance or requests a cash-out of all of
+// it:
+//
+//	/payout
+//	/payout <dana|ovo|gopay|shopeepay> <nomor>
+func handlePayout(c telebot.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	var u models.User
+	if err := database.GetUserCollection().FindOne(ctx, bson.M{"telegram_user_id": c.Sender().ID}).Decode(&u); err != nil {
+		return c.Send("Terjadi kesalahan saat memuat status akun kamu. Coba beberapa saat lagi.")
+	}
+
+	p := message.NewPrinter(language.Indonesian)
+	args := c.Args()
+
+	if len(args) != 2 {
+		var msg strings.Builder
+		msg.WriteString("💰 <b>Saldo Referral</b>\n\n")
+		msg.WriteString(p.Sprintf("💵 Saldo: <b>Rp %d</b>\n", u.ReferralBalance))
+		msg.WriteString(p.Sprintf("ℹ️ Setiap 1 hari bonus referral bernilai Rp %d.\n", models.ReferralPayoutRate))
+		msg.WriteString(p.Sprintf("📤 Minimal pencairan: Rp %d\n\n", minPayoutAmount))
+		msg.WriteString("Cara mencairkan seluruh saldo:\n<code>/payout dana 081234567890</code>\n")
+		msg.WriteString("E-wallet: dana, ovo, gopay, shopeepay")
+
+		var pending models.Payout
+		err := database.GetPayoutCollection().FindOne(ctx, bson.M{"telegramID": u.TelegramUserID, "status": models.PayoutPending}).Decode(&pending)
+		if err == nil {
+			msg.WriteString(p.Sprintf("\n\n⏳ Pencairan <code>%s</code> sebesar Rp %d sedang diproses admin.", pending.PayoutID, pending.Amount))
+		}
+		return c.Send(msg.String(), telebot.ModeHTML)
+	}
+
+	walletKey := strings.ToLower(args[0])
+	wallet, ok := payoutWallets[walletKey]
+	if !ok {
+		return c.Send("⚠️ E-wallet tidak dikenal. Pilih: dana, ovo, gopay, shopeepay.")
+	}
+	number := strings.TrimPrefix(strings.ReplaceAll(args[1], "-", ""), "+62")
+	if strings.HasPrefix(number, "8") {
+		number = "0" + number
+	}
+	if !payoutNumberPattern.MatchString(number) {
+		return c.Send("⚠️ Nomor e-wallet tidak valid. Contoh: 081234567890")
+	}
+
+	amount := u.ReferralBalance
+	if amount < minPayoutAmount {
+		return c.Send(p.Sprintf("⚠️ Saldo kamu Rp %d, minimal pencairan Rp %d.", amount, minPayoutAmount))
+	}
+
+	payout := models.Payout{
+		PayoutID:   generatePayoutID(),
+		TelegramID: u.TelegramUserID,
+		Amount:     amount,
+		Wallet:     wallet,
+		Number:     number,
+		Status:     models.PayoutPending,
+		CreatedAt:  GetJakartaTime(),
+	}
+	err := withTransaction(ctx, func(sc mongo.SessionContext) error {
+		_, err := database.GetPayoutCollection().InsertOne(sc, payout)
+		if mongo.IsDuplicateKeyError(err) {
+			return errPayoutPending
+		}
+		if err != nil {
+			return err
+		}
+		return adjustReferralBalance(sc, models.ReferralLedgerEntry{
+			TelegramID: u.TelegramUserID,
+			Type:       models.LedgerPayoutRequested,
+			Amount:     -amount,
+			PayoutID:   payout.PayoutID,
+			Note:       wallet + " " + number,
+		}, true)
+	})
+	switch {
+	case errors.Is(err, errPayoutPending):
+		return c.Send("⏳ Kamu masih punya pencairan yang sedang diproses admin.")
+	case errors.Is(err, errInsufficientBalance):
+		return c.Send("⚠️ Saldo kamu berubah, silakan coba lagi.")
+	case err != nil:
+		log.Printf("❌ Failed to create payout for %d: %v", u.TelegramUserID, err)
+		return c.Send("❌ Gagal mengajukan pencairan. Coba lagi nanti.")
+	}
+	log.Printf("📤 Payout %s requested by %d (Rp %d)", payout.PayoutID, u.TelegramUserID, amount)
+
+	notifyPayoutRequest(c.Bot(), &payout, &u)
+	return c.Send(p.Sprintf("✅ Pencairan <code>%s</code> sebesar <b>Rp %d</b> ke %s %s sudah diajukan.\nAdmin akan memprosesnya secepatnya. 🙏",
+		payout.PayoutID, amount, wallet, number), telebot.ModeHTML)
+}
+
+func payoutText(p *message.Printer, payout *models.Payout, name string) string {
+	return p.Sprintf("🧾 <code>%s</code>\n👤 %s (<code>%d</code>)\n💵 Rp %d\n📱 %s <code>%s</code>\n⏱ %s WIB",
+		payout.PayoutID, html.EscapeString(name), payout.TelegramID, payout.Amount, payout.Wallet, payout.Number, payout.CreatedAt.Format("02-01-2006 15:04"))
+}
+
+func payoutButtons(menu *telebot.ReplyMarkup, payoutID string) telebot.Row {
+	return menu.Row(
+		menu.Data("✅ Sudah ditransfer", "payout_approve", payoutID),
+		menu.Data("❌ Tolak", "payout_reject", payoutID),
+	)
+}
+
+func notifyPayoutRequest(bot *telebot.Bot, payout *models.Payout, u *models.User) {
+	p := message.NewPrinter(language.Indonesian)
+	menu := &telebot.ReplyMarkup{}
+	menu.Inline(payoutButtons(menu, payout.PayoutID))
+	notifyOwner(bot, "📤 <b>Pengajuan Pencairan Referral</b>\n\n"+payoutText(p, payout, u.TelegramName), menu)
+}
+
+// handlePayoutQueue lists pending cash-outs for the owner.
+func handlePayoutQueue(c telebot.Context) error {
+	if !isOwner(c) {
+		return c.Send("❌ Kamu tidak punya akses ke perintah ini.")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := database.GetPayoutCollection().Find(ctx, bson.M{"status": models.PayoutPending},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}).SetLimit(20))
+	var payouts []models.Payout
+	if err == nil {
+		err = cursor.All(ctx, &payouts)
+	}
+	if err != nil {
+		log.Println("❌ Gagal mengambil antrean pencairan:", err)
+		return c.Send("❌ Gagal mengambil antrean pencairan.")
+	}
+	if len(payouts) == 0 {
+		return c.Send("✅ Tidak ada pencairan yang menunggu.")
+	}
+
+	ids := make([]int64, 0, len(payouts))
+	for _, payout := range payouts {
+		ids = append(ids, payout.TelegramID)
+	}
+	names := make(map[int64]string, len(ids))
+	cursor, err = database.GetUserCollection().Find(ctx, bson.M{"telegram_user_id": bson.M{"$in": ids}},
+		options.Find().SetProjection(bson.M{"telegram_user_id": 1, "telegram_name": 1}))
+	var users []models.User
+	if err == nil {
+		err = cursor.All(ctx, &users)
+	}
+	if err != nil {
+		// Antrean tetap ditampilkan; nama hanya pelengkap
+		log.Println("⚠️ Gagal mengambil nama pengaju pencairan:", err)
+	}
+	for _, u := range users {
+		names[u.TelegramUserID] = u.TelegramName
+	}
+
+	p := message.NewPrinter(language.Indonesian)
+	menu := &telebot.ReplyMarkup{}
+	var rows []telebot.Row
+	var msg strings.Builder
+	msg.WriteString("📤 <b>Antrean Pencairan Referral</b>\n\n")
+	for i := range payouts {
+		name, ok := names[payouts[i].TelegramID]
+		if !ok {
+			name = "(user tidak ditemukan)"
+		}
+		msg.WriteString(payoutText(p, &payouts[i], name))
+		msg.WriteString("\n\n")
+		rows = append(rows, payoutButtons(menu, payouts[i].PayoutID))
+	}
+	menu.Inline(rows...)
+	return c.Send(msg.String(), menu, telebot.ModeHTML)
+}
+
+// handlePayoutDecision approves or rejects a pending cash-out. Rejected
+// amounts go back to the user's balance.
+func handlePayoutDecision(c telebot.Context) error {
+	if !isOwner(c) {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ Kamu tidak punya akses."})
+	}
+	payoutID := c.Data()
+	approve := c.Callback().Unique == "payout_approve"
+
+	status := models.PayoutRejected
+	if approve {
+		status = models.PayoutApproved
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	var payout models.Payout
+	err := withTransaction(ctx, func(sc mongo.SessionContext) error {
+		now := GetJakartaTime()
+		err := database.GetPayoutCollection().FindOneAndUpdate(sc,
+			bson.M{"payoutID": payoutID, "status": models.PayoutPending},
+			bson.M{"$set": bson.M{"status": status, "resolved_at": now}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&payout)
+		if err != nil {
+			return err
+		}
+
+		entry := models.ReferralLedgerEntry{
+			TelegramID: payout.TelegramID,
+			Type:       models.LedgerPayoutApproved,
+			PayoutID:   payout.PayoutID,
+			Note:       payout.Wallet + " " + payout.Number,
+			CreatedAt:  now,
+		}
+		if !approve {
+			entry.Type = models.LedgerPayoutRejected
+			entry.Amount = payout.Amount
+		}
+		return adjustReferralBalance(sc, entry, false)
+	})
+	if err == mongo.ErrNoDocuments {
+		return c.Respond(&telebot.CallbackResponse{Text: "⚠️ Pencairan ini sudah diproses."})
+	}
+	if err != nil {
+		log.Printf("❌ Failed to resolve payout %s: %v", payoutID, err)
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ Gagal memproses pencairan."})
+	}
+	log.Printf("📤 Payout %s %s", payoutID, status)
+
+	p := message.NewPrinter(language.Indonesian)
+	userMsg := p.Sprintf("✅ Pencairan <code>%s</code> sebesar <b>Rp %d</b> sudah ditransfer ke %s %s. Terima kasih sudah mengajak teman! 💖",
+		payout.PayoutID, payout.Amount, payout.Wallet, payout.Number)
+	ownerMsg := fmt.Sprintf("✅ <code>%s</code> ditandai sudah ditransfer.", payoutID)
+	if !approve {
+		userMsg = p.Sprintf("❌ Pencairan <code>%s</code> ditolak admin. Saldo Rp %d sudah dikembalikan.\n📩 Ada pertanyaan? Chat admin: @domi_nuc",
+			payout.PayoutID, payout.Amount)
+		ownerMsg = fmt.Sprintf("❌ <code>%s</code> ditolak, saldo dikembalikan.", payoutID)
+	}
+	c.Bot().Send(&telebot.User{ID: payout.TelegramID}, userMsg, telebot.ModeHTML)
+
+	_ = c.Respond()
+	return c.Edit(ownerMsg, telebot.ModeHTML)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/telebot.v3"
+
+	"transferin-drama/database"
+	"transferin-drama/models"
+)
+
+const (
+	defaultFreeDailyQuota = 10
+	defaultFreeParts      = 3
+)
+
+// errQuotaExhausted is returned by consumeQuota when a free user has no
+// daily or bonus quota left.
+var errQuotaExhausted = errors.New("free quota exhausted")
+
+// freeDailyQuota is how many free parts a non-VIP user may watch per day
+// (FREE_DAILY_QUOTA).
+func freeDailyQuota() int {
+	if n, err := strconv.Atoi(os.Getenv("FREE_DAILY_QUOTA")); err == nil && n >= 0 {
+		return n
+	}
+	return defaultFreeDailyQuota
+}
+
+// freePartsPerDrama is how many parts at the start of every drama are free
+// to watch without VIP (FREE_PARTS_PER_DRAMA).
+func freePartsPerDrama() int {
+	if n, err := strconv.Atoi(os.Getenv("FREE_PARTS_PER_DRAMA")); err == nil && n >= 0 {
+		return n
+	}
+	return defaultFreeParts
+}
+
+func isFreePart(part int) bool {
+	return part <= freePartsPerDrama()
+}
+
+var wib = time.FixedZone("WIB", 7*60*60)
+
+// quotaDay is the WIB calendar day the daily quota belongs to, so it resets
+// at midnight WIB whatever the server's time zone.
+func quotaDay(t time.Time) string {
+	return t.In(wib).Format("2006-01-02")
+}
+
+// quotaLeft returns the daily and bonus quota u has left at now.
+func quotaLeft(u *models.User, now time.Time) (daily, bonus int) {
+	daily = freeDailyQuota()
+	if u.QuotaDay == quotaDay(now) {
+		daily -= u.QuotaUsed
+	}
+	if daily < 0 {
+		daily = 0
+	}
+	return daily, u.BonusQuota
+}
+
+// consumeQuota spends one free view of userID: from today's quota first and
+// from bonus quota once that is used up. The check and the update are a
+// single write, so concurrent taps cannot overspend. It returns the user as
+// updated.
+func consumeQuota(ctx context.Context, userID int64, now time.Time) (*models.User, error) {
+	today := quotaDay(now)
+	limit := freeDailyQuota()
+	used := bson.D{{Key: "$ifNull", Value: bson.A{"$quota_used", 0}}}
+
+	var u models.User
+	err := database.GetUserCollection().FindOneAndUpdate(ctx,
+		bson.M{
+			"telegram_user_id": userID,
+			"$or": bson.A{
+				bson.M{"quota_day": bson.M{"$ne": today}},
+				bson.M{"quota_used": bson.M{"$not": bson.M{"$gte": limit}}},
+				bson.M{"bonus_quota": bson.M{"$gt": 0}},
+			},
+		},
+		mongo.Pipeline{
+			// Hari baru WIB: kuota harian mulai dari nol lagi
+			{{Key: "$set", Value: bson.D{
+				{Key: "quota_used", Value: bson.D{{Key: "$cond", Value: bson.A{
+					bson.D{{Key: "$eq", Value: bson.A{"$quota_day", today}}}, used, 0,
+				}}}},
+				{Key: "quota_day", Value: today},
+			}}},
+			{{Key: "$set", Value: bson.D{
+				{Key: "bonus_quota", Value: bson.D{{Key: "$cond", Value: bson.A{
+					bson.D{{Key: "$lt", Value: bson.A{"$quota_used", limit}}},
+					"$bonus_quota",
+					bson.D{{Key: "$subtract", Value: bson.A{"$bonus_quota", 1}}},
+				}}}},
+				{Key: "quota_used", Value: bson.D{{Key: "$cond", Value: bson.A{
+					bson.D{{Key: "$lt", Value: bson.A{"$quota_used", limit}}},
+					bson.D{{Key: "$add", Value: bson.A{"$quota_used", 1}}},
+					"$quota_used",
+				}}}},
+			}}},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&u)
+	if err == mongo.ErrNoDocuments {
+		return nil, errQuotaExhausted
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// grantBonusQuota adds free views that do not reset at midnight, e.g. from
+// the owner or a promotion. A zero userID grants them to every non-VIP user.
+func grantBonusQuota(ctx context.Context, userID int64, views int) (int64, error) {
+	filter := bson.M{"telegram_user_id": userID}
+	if userID == 0 {
+		filter = bson.M{"is_vip": bson.M{"$ne": true}}
+	}
+	res, err := database.GetUserCollection().UpdateMany(ctx, filter, bson.M{"$inc": bson.M{"bonus_quota": views}})
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+// handleAddQuota gives bonus quota to one user or to all free users:
+//
+//	/addquota <username|userID|all> <jumlah>
+func handleAddQuota(c telebot.Context) error {
+	if !isOwner(c) {
+		return c.Send("❌ Kamu tidak punya akses ke perintah ini.")
+	}
+
+	args := c.Args()
+	if len(args) != 2 {
+		return c.Send("⚠️ Format salah!\nContoh: /addquota 123456789 5\natau: /addquota all 3")
+	}
+	views, err := strconv.Atoi(args[1])
+	if err != nil || views <= 0 {
+		return c.Send("⚠️ Jumlah kuota tidak valid.")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var target *models.User
+	if !strings.EqualFold(args[0], "all") {
+		target, err = findGiftRecipient(ctx, args[0])
+		if err != nil {
+			return c.Send("❌ User tidak ditemukan.")
+		}
+	}
+
+	var userID int64
+	if target != nil {
+		userID = target.TelegramUserID
+	}
+	n, err := grantBonusQuota(ctx, userID, views)
+	if err != nil {
+		log.Println("❌ Gagal menambah kuota bonus:", err)
+		return c.Send("❌ Gagal menambah kuota bonus.")
+	}
+	log.Printf("🎟️ Owner granted %d bonus views to %d users", views, n)
+
+	if target == nil {
+		return c.Send(fmt.Sprintf("✅ %d kuota bonus ditambahkan ke %d user gratis.", views, n))
+	}
+	c.Bot().Send(&telebot.User{ID: target.TelegramUserID}, fmt.Sprintf(
+		"🎁 Kamu dapat <b>%d kuota nonton bonus</b>! Kuota ini dipakai setelah kuota harian habis dan tidak hangus di tengah malam.", views,
+	), telebot.ModeHTML)
+	return c.Send(fmt.Sprintf("✅ %d kuota bonus ditambahkan ke %s.", views, giftRecipientName(target)))
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/telebot.v3"
+
+	"transferin-drama/database"
+	"transferin-drama/models"
+	"transferin-drama/payment"
+)
+
+// pendingFallbackTTL expires transactions that never received an invoice.
+const pendingFallbackTTL = 24 * time.Hour
+
+// maxActivationErrors is how many ticks a paid transaction may fail to
+// activate before it is handed to the owner's review queue.
+const maxActivationErrors = 3
+
+// reconcileReportMaxIDs caps how many transaction IDs one report lists.
+const reconcileReportMaxIDs = 80
+
+type reconcileReport struct {
+	Activated []string
+	Expired   []string
+	Flagged   []string
+	Failed    []string
+}
+
+func (r reconcileReport) empty() bool {
+	return len(r.Activated)+len(r.Expired)+len(r.Flagged)+len(r.Failed) == 0
+}
+
+// startPendingReconciler periodically checks every open transaction
+// with the gateway, so a lost webhook never leaves a paying user without VIP.
+func startPendingReconciler(ctx context.Context, bot *telebot.Bot, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	log.Printf("✅ Pending transaction reconciler started (every %s)", interval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("🛑 Pending transaction reconciler stopped")
+			return
+		case <-ticker.C:
+			report := reconcilePendingTransactions(ctx, bot)
+			if !report.empty() {
+				notifyOwner(bot, report.String())
+			}
+		}
+	}
+}
+
+func reconcilePendingTransactions(ctx context.Context, bot *telebot.Bot) reconcileReport {
+	var report reconcileReport
+
+	findCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	cursor, err := database.GetTransactionCollection().Find(findCtx, bson.M{
+		"state": bson.M{"$in": bson.A{models.StateCreated, models.StateAwaitingPayment}},
+	})
+	if err != nil {
+		log.Printf("❌ Reconciler failed to list open transactions: %v", err)
+		return report
+	}
+
+	var pendings []models.Transaction
+	if err := cursor.All(findCtx, &pendings); err != nil {
+		log.Printf("❌ Reconciler failed to decode open transactions: %v", err)
+		return report
+	}
+
+	now := time.Now()
+	for _, pendingTx := range pendings {
+		if ctx.Err() != nil {
+			return report
+		}
+
+		// No invoice was ever created at the gateway, nothing to ask about.
+		if pendingTx.State == models.StateCreated {
+			if now.After(pendingTx.CreatedAt.Add(pendingFallbackTTL)) && markPendingExpired(ctx, pendingTx.TransactionID, "invoice never created") {
+				report.Expired = append(report.Expired, pendingTx.TransactionID)
+			}
+			continue
+		}
+
+		expiry := pendingTx.ExpiredAt
+		if expiry.IsZero() {
+			expiry = pendingTx.CreatedAt.Add(pendingFallbackTTL)
+		}
+
+		// Stars payments arrive as bot updates, the gateway knows nothing of them.
+		if pendingTx.Provider == starsProvider {
+			if now.After(expiry) && markPendingExpired(ctx, pendingTx.TransactionID, "Stars invoice expired") {
+				report.Expired = append(report.Expired, pendingTx.TransactionID)
+			}
+			continue
+		}
+
+		queryCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+		status, err := paymentProvider.QueryStatus(queryCtx, pendingTx.TransactionID, pendingTx.Amount)
+		cancel()
+
+		switch {
+		case err == nil && status.Status == payment.StatusCompleted:
+			err := activatePayment(pendingTx.TransactionID, status.Amount, status.PayerName, bot)
+			switch {
+			case err == nil:
+				report.Activated = append(report.Activated, pendingTx.TransactionID)
+			case errors.Is(err, errNeedsReview):
+				report.Flagged = append(report.Flagged, pendingTx.TransactionID)
+			default:
+				log.Printf("❌ Reconciler could not activate %s: %v", pendingTx.TransactionID, err)
+				// Laporkan sekali, lalu serahkan ke owner setelah beberapa kali gagal
+				switch failures := recordActivationError(ctx, pendingTx.TransactionID); {
+				case failures >= maxActivationErrors:
+					queueForReview(ctx, bot, &pendingTx, status.Amount, models.ReviewActivationFail, nil)
+					report.Flagged = append(report.Flagged, pendingTx.TransactionID)
+				case failures == 1:
+					report.Failed = append(report.Failed, pendingTx.TransactionID)
+				}
+			}
+
+		case err == nil && (status.Status == payment.StatusExpired || status.Status == payment.StatusCancelled),
+			now.After(expiry):
+			if markPendingExpired(ctx, pendingTx.TransactionID, "expired by reconciler") {
+				report.Expired = append(report.Expired, pendingTx.TransactionID)
+			}
+
+		case err != nil:
+			log.Printf("⚠️ Reconciler could not query %s: %v", pendingTx.TransactionID, err)
+		}
+	}
+
+	return report
+}
+
+// recordActivationError counts a failed activation of transactionID and
+// returns how many there have been, or 0 if the count could not be stored.
+func recordActivationError(ctx context.Context, transactionID string) int {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var tx models.Transaction
+	err := database.GetTransactionCollection().FindOneAndUpdate(ctx,
+		bson.M{"transactionID": transactionID},
+		bson.M{"$inc": bson.M{"activation_errors": 1}, "$set": bson.M{"updated_at": GetJakartaTime()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&tx)
+	if err != nil {
+		log.Printf("⚠️ Failed to record activation error of %s: %v", transactionID, err)
+		return 0
+	}
+	return tx.ActivationErrors
+}
+
+func markPendingExpired(ctx context.Context, transactionID, note string) bool {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	tx, err := transitionTransaction(ctx, transactionID, models.StateExpired, note, nil)
+	if err != nil {
+		log.Printf("❌ Failed to expire transaction %s: %v", transactionID, err)
+		return false
+	}
+	releaseVoucher(ctx, tx)
+	return true
+}
+
+func (r reconcileReport) String() string {
+	var msg strings.Builder
+	msg.WriteString("🧹 <b>Rekonsiliasi Transaksi</b>\n\n")
+	msg.WriteString(fmt.Sprintf("✅ Diaktifkan (webhook terlewat): %d\n", len(r.Activated)))
+	msg.WriteString(fmt.Sprintf("⌛ Kedaluwarsa: %d\n", len(r.Expired)))
+	msg.WriteString(fmt.Sprintf("⚠️ Perlu review: %d\n", len(r.Flagged)))
+	msg.WriteString(fmt.Sprintf("❌ Gagal diproses: %d\n", len(r.Failed)))
+
+	// Yang perlu tindakan owner ditulis lebih dulu; sisanya dipotong agar
+	// pesan tetap di bawah batas 4096 karakter Telegram
+	listed := 0
+	for _, group := range []struct {
+		icon string
+		ids  []string
+	}{
+		{"⚠️", r.Flagged},
+		{"❌", r.Failed},
+		{"✅", r.Activated},
+		{"⌛", r.Expired},
+	} {
+		for _, id := range group.ids {
+			if listed == reconcileReportMaxIDs {
+				break
+			}
+			msg.WriteString(fmt.Sprintf("\n%s <code>%s</code>", group.icon, id))
+			listed++
+		}
+	}
+	if total := len(r.Activated) + len(r.Expired) + len(r.Flagged) + len(r.Failed); total > listed {
+		msg.WriteString(fmt.Sprintf("\n… dan %d lainnya", total-listed))
+	}
+	return msg.String()
+}
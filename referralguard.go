@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/telebot.v3"
+
+	"transferin-drama/database"
+	"transferin-drama/models"
+)
+
+const (
+	// referralMinAccountAge is how long a buyer must have used the bot
+	// before their purchase pays referral bonuses automatically.
+	referralMinAccountAge = 24 * time.Hour
+	// referralWeeklyCapDays bounds the referral bonus days one referrer
+	// receives automatically in 7 days.
+	referralWeeklyCapDays = 15
+)
+
+var referralFlagLabels = map[string]string{
+	models.ReferralFlagNewAccount:  "akun pembeli baru dibuat",
+	models.ReferralFlagWeeklyCap:   "batas bonus mingguan referrer terlampaui",
+	models.ReferralFlagSharedPayer: "nama pembayar QRIS sama dengan referral lain",
+	models.ReferralFlagCircular:    "saling referral",
+}
+
+// normalizePayerName makes payer names reported by the gateway comparable.
+func normalizePayerName(name string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(name), " "))
+}
+
+// checkReferral applies the referral abuse rules to a purchase by payer. It
+// returns the hold to record when the bonuses must wait for the owner, or
+// nil when they can be granted right away. It must run inside sc.
+func checkReferral(sc mongo.SessionContext, tx *models.Transaction, payer *models.User, payerBonus, referrerBonus int, now time.Time) (*models.ReferralHold, error) {
+	var referrer models.User
+	err := database.GetUserCollection().FindOne(sc, bson.M{"code": payer.ReferralCode}).Decode(&referrer)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var flags []string
+	if referrer.ReferralCode != "" && referrer.ReferralCode == payer.Code {
+		flags = append(flags, models.ReferralFlagCircular)
+	}
+	if now.Sub(payer.CreatedAt) < referralMinAccountAge {
+		flags = append(flags, models.ReferralFlagNewAccount)
+	}
+
+	if referrerBonus > 0 {
+		cursor, err := database.GetVIPGrantCollection().Aggregate(sc, mongo.Pipeline{
+			{{Key: "$match", Value: bson.M{
+				"telegramID": referrer.TelegramUserID,
+				"type":       models.GrantReferral,
+				"created_at": bson.M{"$gte": now.AddDate(0, 0, -7)},
+			}}},
+			{{Key: "$group", Value: bson.M{"_id": nil, "days": bson.M{"$sum": "$days"}}}},
+		})
+		if err != nil {
+			return nil, err
+		}
+		var week struct {
+			Days int `bson:"days"`
+		}
+		if cursor.Next(sc) {
+			err = cursor.Decode(&week)
+		}
+		cursor.Close(sc)
+		if err != nil {
+			return nil, err
+		}
+		if week.Days+referrerBonus > referralWeeklyCapDays {
+			flags = append(flags, models.ReferralFlagWeeklyCap)
+		}
+	}
+
+	// Pembayar yang sama untuk beberapa teman, atau untuk referrer sendiri,
+	// biasanya berarti akun-akun itu milik satu orang.
+	if tx.PayerName != "" {
+		n, err := database.GetTransactionCollection().CountDocuments(sc, bson.M{
+			"payer_name": tx.PayerName,
+			"telegramID": bson.M{"$ne": payer.TelegramUserID},
+			"state":      bson.M{"$in": bson.A{models.StatePaid, models.StateActivated}},
+			"$or": bson.A{
+				bson.M{"referral_code": payer.ReferralCode},
+				bson.M{"telegramID": referrer.TelegramUserID},
+			},
+		}, options.Count().SetLimit(1))
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			flags = append(flags, models.ReferralFlagSharedPayer)
+		}
+	}
+
+	if len(flags) == 0 {
+		return nil, nil
+	}
+	log.Printf("🚩 Referral bonus for %s held: %v", tx.TransactionID, flags)
+	return &models.ReferralHold{
+		Flags:         flags,
+		ReferrerID:    referrer.TelegramUserID,
+		PayerBonus:    payerBonus,
+		ReferrerBonus: referrerBonus,
+		Status:        models.ReferralHoldPending,
+	}, nil
+}
+
+func referralFlagsText(flags []string) string {
+	labels := make([]string, 0, len(flags))
+	for _, f := range flags {
+		labels = append(labels, referralFlagLabels[f])
+	}
+	return strings.Join(labels, ", ")
+}
+
+func referralHoldButtons(menu *telebot.ReplyMarkup, transactionID string) telebot.Row {
+	return menu.Row(
+		menu.Data("✅ Berikan bonus", "referral_approve", transactionID),
+		menu.Data("❌ Tolak", "referral_reject", transactionID),
+	)
+}
+
+// notifyReferralHold asks the owner to decide on a held referral bonus.
+func notifyReferralHold(bot *telebot.Bot, transactionID string, payer *models.User, hold *models.ReferralHold) {
+	menu := &telebot.ReplyMarkup{}
+	menu.Inline(referralHoldButtons(menu, transactionID))
+	notifyOwner(bot, fmt.Sprintf(
+		"🚩 <b>Bonus referral ditahan</b>\n\n"+
+			"🧾 <code>%s</code>\n"+
+			"👤 Pembeli: %s (<code>%d</code>)\n"+
+			"🤝 Referrer: <code>%d</code>\n"+
+			"🎁 Bonus: pembeli %d hari, referrer %d hari\n"+
+			"📌 Alasan: %s",
+		transactionID, html.EscapeString(payer.TelegramName), payer.TelegramUserID, hold.ReferrerID,
+		hold.PayerBonus, hold.ReferrerBonus, referralFlagsText(hold.Flags),
+	), menu)
+}
+
+// handleReferralHolds lists referral bonuses waiting for an owner decision:
+//
+//	/referralholds
+func handleReferralHolds(c telebot.Context) error {
+	if !isOwner(c) {
+		return c.Send("❌ Kamu tidak punya akses ke perintah ini.")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := database.GetTransactionCollection().Find(ctx,
+		bson.M{"state": models.StateActivated, "referral_hold.status": models.ReferralHoldPending},
+		options.Find().SetSort(bson.D{{Key: "activated_at", Value: 1}}).SetLimit(20))
+	var txs []models.Transaction
+	if err == nil {
+		err = cursor.All(ctx, &txs)
+	}
+	if err != nil {
+		log.Println("❌ Gagal mengambil bonus referral yang ditahan:", err)
+		return c.Send("❌ Gagal mengambil bonus referral yang ditahan.")
+	}
+	if len(txs) == 0 {
+		return c.Send("✅ Tidak ada bonus referral yang ditahan.")
+	}
+
+	menu := &telebot.ReplyMarkup{}
+	var rows []telebot.Row
+	var msg strings.Builder
+	msg.WriteString("🚩 <b>Bonus Referral Ditahan</b>\n\n")
+	for _, tx := range txs {
+		hold := tx.ReferralHold
+		msg.WriteString(fmt.Sprintf("🧾 <code>%s</code>\n👤 <code>%d</code> → 🤝 <code>%d</code>\n🎁 %d + %d hari\n📌 %s\n\n",
+			tx.TransactionID, tx.TelegramID, hold.ReferrerID, hold.PayerBonus, hold.ReferrerBonus, referralFlagsText(hold.Flags)))
+		rows = append(rows, referralHoldButtons(menu, tx.TransactionID))
+	}
+	menu.Inline(rows...)
+	return c.Send(msg.String(), menu, telebot.ModeHTML)
+}
+
+// handleReferralHoldDecision grants or drops a held referral bonus.
+func handleReferralHoldDecision(c telebot.Context) error {
+	if !isOwner(c) {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ Kamu tidak punya akses."})
+	}
+	transactionID := c.Data()
+	approve := c.Callback().Unique == "referral_approve"
+
+	lock := getPaymentLock(transactionID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := getTransaction(ctx, transactionID)
+	if err != nil || tx.State != models.StateActivated || tx.ReferralHold == nil || tx.ReferralHold.Status != models.ReferralHoldPending {
+		return c.Respond(&telebot.CallbackResponse{Text: "⚠️ Bonus ini sudah tidak ditahan."})
+	}
+	hold := tx.ReferralHold
+
+	var payer models.User
+	var referrer *models.User
+	err = withTransaction(ctx, func(sc mongo.SessionContext) error {
+		txCol := database.GetTransactionCollection()
+		now := GetJakartaTime()
+
+		status := models.ReferralHoldRejected
+		set := bson.M{"referral_hold.resolved_at": now, "updated_at": now}
+		if approve {
+			status = models.ReferralHoldApproved
+			set["bonus_days"] = hold.PayerBonus
+		}
+		set["referral_hold.status"] = status
+
+		res, err := txCol.UpdateOne(sc,
+			bson.M{"transactionID": transactionID, "state": models.StateActivated, "referral_hold.status": models.ReferralHoldPending},
+			bson.M{"$set": set},
+		)
+		if err != nil {
+			return err
+		}
+		if res.ModifiedCount == 0 {
+			return fmt.Errorf("%w: referral hold of %s already resolved", errInvalidTransition, transactionID)
+		}
+		if !approve {
+			return nil
+		}
+
+		if err := database.GetUserCollection().FindOne(sc, bson.M{"telegram_user_id": tx.TelegramID}).Decode(&payer); err != nil {
+			return err
+		}
+		if hold.PayerBonus > 0 {
+			if _, err := extendVIP(sc, tx.TelegramID, hold.PayerBonus, now); err != nil {
+				return err
+			}
+		}
+		if hold.ReferrerBonus > 0 {
+			// Kode yang dipakai saat pembelian, bukan yang sekarang
+			payer.ReferralCode = tx.ReferralCode
+			referrer, err = creditReferrer(sc, tx, &payer, hold.ReferrerBonus, now)
+			if err != nil {
+				return err
+			}
+			if referrer != nil {
+				_, err = txCol.UpdateOne(sc, bson.M{"transactionID": transactionID}, bson.M{
+					"$push": bson.M{"referral_payouts": models.ReferralPayout{
+						TelegramID: referrer.TelegramUserID,
+						Code:       tx.ReferralCode,
+						Days:       hold.ReferrerBonus,
+					}},
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("❌ Failed to resolve referral hold of %s: %v", transactionID, err)
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ Gagal memproses bonus referral."})
+	}
+
+	if !approve {
+		log.Printf("🚩 Referral bonus for %s rejected by owner", transactionID)
+		_ = c.Respond(&telebot.CallbackResponse{Text: "❌ Ditolak."})
+		return c.Edit(fmt.Sprintf("❌ Bonus referral <code>%s</code> ditolak.", transactionID), telebot.ModeHTML)
+	}
+
+	log.Printf("✅ Referral bonus for %s approved by owner", transactionID)
+	if hold.PayerBonus > 0 {
+		c.Bot().Send(&telebot.User{ID: tx.TelegramID}, fmt.Sprintf(
+			"🎁 Bonus referral <b>%d hari</b> dari pembelian <code>%s</code> sudah ditambahkan ke VIP kamu!",
+			hold.PayerBonus, transactionID,
+		), telebot.ModeHTML)
+	}
+	if referrer != nil {
+		go sendReferralNotification(c.Bot(), referrer, &payer, hold.ReferrerBonus)
+	}
+
+	_ = c.Respond(&telebot.CallbackResponse{Text: "✅ Bonus diberikan."})
+	return c.Edit(fmt.Sprintf("✅ Bonus referral <code>%s</code> diberikan.", transactionID), telebot.ModeHTML)
+}
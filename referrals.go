@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"gopkg.in/telebot.v3"
+
+	"transferin-drama/database"
+	"transferin-drama/models"
+)
+
+// referralStartPrefix marks a /start payload that carries a referral code.
+const referralStartPrefix = "ref_"
+
+// recentReferralsLimit bounds the list of referred users on /referrals.
+const recentReferralsLimit = 10
+
+// referralLink is the deep link that sets code as the referral on /start.
+func referralLink(code string) string {
+	return "https://t.me/dramatrans_bot?start=" + referralStartPrefix + code
+}
+
+// maskName hides most of every word of a name, e.g. "Budi Santoso" becomes
+// "Bu** Sa*****".
+func maskName(name string) string {
+	words := strings.Fields(name)
+	if len(words) == 0 {
+		return "***"
+	}
+	for i, w := range words {
+		keep := 2
+		if utf8.RuneCountInString(w) <= 2 {
+			keep = 1
+		}
+		runes := []rune(w)
+		words[i] = string(runes[:keep]) + strings.Repeat("*", len(runes)-keep)
+	}
+	return strings.Join(words, " ")
+}
+
+// handleReferrals shows how the user's referral code is doing:
+//
+//	/referrals
+func handleReferrals(c telebot.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	userCol := database.GetUserCollection()
+
+	var u models.User
+	if err := userCol.FindOne(ctx, bson.M{"telegram_user_id": c.Sender().ID}).Decode(&u); err != nil {
+		return c.Send("Terjadi kesalahan saat memuat status akun kamu. Coba beberapa saat lagi.")
+	}
+	if u.Code == "" {
+		return c.Send("Kamu belum punya kode referral. Ketik /start untuk mendaftar dulu ya.")
+	}
+
+	joined, err := userCol.CountDocuments(ctx, bson.M{"referral_code": u.Code})
+	if err != nil {
+		log.Println("❌ Gagal menghitung referral:", err)
+		return c.Send("❌ Gagal memuat data referral. Coba beberapa saat lagi.")
+	}
+
+	// Pembeli dan bonus dihitung dari transaksi yang masih aktif, jadi
+	// pembelian yang direfund tidak ikut terhitung.
+	var stats struct {
+		Buyers []int64 `bson:"buyers"`
+		Days   int     `bson:"days"`
+	}
+	cursor, err := database.GetTransactionCollection().Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"referral_code": u.Code, "state": models.StateActivated}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":    nil,
+			"buyers": bson.M{"$addToSet": "$telegramID"},
+			"days":   bson.M{"$sum": bson.M{"$sum": "$referral_payouts.days"}},
+		}}},
+	})
+	if err == nil {
+		if cursor.Next(ctx) {
+			err = cursor.Decode(&stats)
+		}
+		cursor.Close(ctx)
+	}
+	if err != nil {
+		log.Println("❌ Gagal menghitung pembelian referral:", err)
+		return c.Send("❌ Gagal memuat data referral. Coba beberapa saat lagi.")
+	}
+	buyers := make(map[int64]bool, len(stats.Buyers))
+	for _, id := range stats.Buyers {
+		buyers[id] = true
+	}
+
+	var pending models.Payout
+	pendingErr := database.GetPayoutCollection().FindOne(ctx, bson.M{"telegramID": u.TelegramUserID, "status": models.PayoutPending}).Decode(&pending)
+
+	var recent []models.User
+	cursor, err = userCol.Find(ctx, bson.M{"referral_code": u.Code},
+		options.Find().
+			SetSort(bson.D{{Key: "created_at", Value: -1}}).
+			SetLimit(recentReferralsLimit).
+			SetProjection(bson.M{"telegram_user_id": 1, "telegram_name": 1, "created_at": 1}))
+	if err == nil {
+		err = cursor.All(ctx, &recent)
+	}
+	if err != nil {
+		log.Println("❌ Gagal mengambil daftar referral:", err)
+	}
+
+	p := message.NewPrinter(language.Indonesian)
+	link := referralLink(u.Code)
+
+	var msg strings.Builder
+	msg.WriteString("🤝 <b>Referral Kamu</b>\n\n")
+	msg.WriteString(fmt.Sprintf("🔑 Kode: <code>%s</code>\n", u.Code))
+	msg.WriteString(fmt.Sprintf("🔗 Link: %s\n\n", link))
+	msg.WriteString(p.Sprintf("👥 Teman bergabung: <b>%d</b>\n", joined))
+	msg.WriteString(p.Sprintf("💎 Teman beli VIP: <b>%d</b>\n", len(stats.Buyers)))
+	msg.WriteString(p.Sprintf("🎁 Total bonus: <b>%d hari</b>\n", stats.Days))
+	msg.WriteString(p.Sprintf("💵 Saldo bisa dicairkan: <b>Rp %d</b>\n", u.ReferralBalance))
+	if pendingErr == nil {
+		msg.WriteString(p.Sprintf("⏳ Sedang diproses: <b>Rp %d</b>\n", pending.Amount))
+	}
+
+	if len(recent) > 0 {
+		msg.WriteString("\n🕒 <b>Terbaru</b>\n")
+		for _, r := range recent {
+			mark := "▫️"
+			if buyers[r.TelegramUserID] {
+				mark = "💎"
+			}
+			msg.WriteString(fmt.Sprintf("%s %s • %s\n", mark, maskName(r.TelegramName), r.CreatedAt.Format("02-01-2006")))
+		}
+	}
+	msg.WriteString("\nBagikan link di atas. Teman yang membukanya otomatis memakai kode kamu. Cairkan saldo lewat /payout.")
+
+	shareURL := "https://t.me/share/url?url=" + url.QueryEscape(link) +
+		"&text=" + url.QueryEscape("Nonton drama China/Korea/Barat langsung dari Telegram, yuk gabung DRAMATRANS!")
+	menu := &telebot.ReplyMarkup{}
+	menu.Inline(menu.Row(menu.URL("📤 Bagikan link", shareURL)))
+
+	return c.Send(msg.String(), menu, telebot.ModeHTML, telebot.NoPreview)
+}
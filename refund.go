@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"gopkg.in/telebot.v3"
+
+	"transferin-drama/database"
+	"transferin-drama/models"
+	"transferin-drama/payment"
+)
+
+// revocation is one user's VIP days taken back by a refund.
+type revocation struct {
+	TelegramID int64
+	Days       int
+	Referral   bool
+	// Debt is how far the referral balance went below zero because the
+	// bonus was already cashed out or is locked in a payout request.
+	Debt int
+}
+
+// refundRevocations lists the days a transaction granted: the package,
+// voucher and referral bonus for whoever received VIP, plus every referrer
+// payout. Nothing was granted before activation.
+func refundRevocations(tx *models.Transaction) []revocation {
+	if tx.State != models.StateActivated {
+		return nil
+	}
+
+	beneficiaryID := tx.TelegramID
+	if tx.RecipientID != 0 {
+		beneficiaryID = tx.RecipientID
+	}
+	revs := []revocation{{TelegramID: beneficiaryID, Days: tx.Duration + tx.VoucherDays + tx.BonusDays}}
+	for _, payout := range tx.ReferralPayouts {
+		revs = append(revs, revocation{TelegramID: payout.TelegramID, Days: payout.Days, Referral: true})
+	}
+	return revs
+}
+
+// handleRefund shows what refunding a transaction would revoke and asks the
+// owner to confirm:
+//
+//	/refund <transactionID>
+func handleRefund(c telebot.Context) error {
+	if !isOwner(c) {
+		return c.Send("❌ Kamu tidak punya akses ke perintah ini.")
+	}
+
+	args := c.Args()
+	if len(args) != 1 {
+		return c.Send("⚠️ Format salah!\nContoh: <code>/refund INV-20250101120000-0001-abcd1234</code>", telebot.ModeHTML)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := getTransaction(ctx, args[0])
+	if err != nil {
+		return c.Send("❌ Transaksi tidak ditemukan.")
+	}
+	if !tx.State.CanTransition(models.StateRefunded) {
+		return c.Send(fmt.Sprintf("⚠️ Transaksi berstatus %s dan tidak bisa direfund.", transactionStateLabels[tx.State]))
+	}
+
+	var msg strings.Builder
+	msg.WriteString("↩️ <b>Konfirmasi Refund</b>\n\n")
+	msg.WriteString(fmt.Sprintf("🧾 <code>%s</code>\n", tx.TransactionID))
+	msg.WriteString(fmt.Sprintf("👤 Pembeli: <code>%d</code>\n", tx.TelegramID))
+	msg.WriteString(fmt.Sprintf("📦 Paket: %s\n", tx.PackageCode))
+	msg.WriteString(fmt.Sprintf("💳 Dibayar: %s via %s\n", formatAmount(tx.Currency, tx.PaidAmount), tx.Provider))
+	msg.WriteString(fmt.Sprintf("📌 Status: %s\n", transactionStateLabels[tx.State]))
+
+	revs := refundRevocations(tx)
+	if len(revs) > 0 {
+		msg.WriteString("\n🔻 VIP yang ditarik:\n")
+		for _, rev := range revs {
+			label := ""
+			if rev.Referral {
+				label = " (bonus referral)"
+			}
+			msg.WriteString(fmt.Sprintf("• <code>%d</code>: %d hari%s\n", rev.TelegramID, rev.Days, label))
+		}
+	}
+	if _, ok := refunderFor(tx); !ok {
+		msg.WriteString("\n⚠️ Gateway tidak mendukung refund otomatis, kembalikan dana secara manual.")
+	}
+
+	menu := &telebot.ReplyMarkup{}
+	menu.Inline(menu.Row(menu.Data("↩️ Refund sekarang", "refund_confirm", tx.TransactionID)))
+	return c.Send(msg.String(), menu, telebot.ModeHTML)
+}
+
+// refunderFor returns how to give the money of tx back, if its provider
+// supports it.
+func refunderFor(tx *models.Transaction) (func(ctx context.Context, bot *telebot.Bot) error, bool) {
+	if tx.Provider == starsProvider {
+		return func(ctx context.Context, bot *telebot.Bot) error {
+			return refundStarPayment(bot, tx.TelegramID, tx.TelegramChargeID)
+		}, true
+	}
+
+	refunder, ok := paymentProvider.(payment.Refunder)
+	if !ok || tx.Provider != paymentProvider.Name() {
+		return nil, false
+	}
+	return func(ctx context.Context, bot *telebot.Bot) error {
+		return refunder.Refund(ctx, tx.TransactionID, tx.PaidAmount)
+	}, true
+}
+
+// refundStarPayment returns a Telegram Stars payment to the payer. telebot
+// has no wrapper for this method yet.
+func refundStarPayment(bot *telebot.Bot, userID int64, chargeID string) error {
+	if chargeID == "" {
+		return errors.New("transaction has no Telegram charge ID")
+	}
+	data, err := bot.Raw("refundStarPayment", map[string]interface{}{
+		"user_id":                    userID,
+		"telegram_payment_charge_id": chargeID,
+	})
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		OK bool `json:"ok"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil || !resp.OK {
+		return fmt.Errorf("refundStarPayment failed: %s", data)
+	}
+	return nil
+}
+
+// handleRefundConfirm refunds the payment at its provider, takes back the
+// VIP days it granted and marks the transaction refunded.
+func handleRefundConfirm(c telebot.Context) error {
+	if !isOwner(c) {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ Kamu tidak punya akses."})
+	}
+	transactionID := c.Data()
+
+	lock := getPaymentLock(transactionID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := getTransaction(ctx, transactionID)
+	if err != nil || !tx.State.CanTransition(models.StateRefunded) {
+		return c.Respond(&telebot.CallbackResponse{Text: "⚠️ Transaksi ini sudah tidak bisa direfund."})
+	}
+
+	// Uang dikembalikan dulu; kalau gagal, VIP tidak ditarik
+	manual := true
+	if refund, ok := refunderFor(tx); ok {
+		if err := refund(ctx, c.Bot()); err != nil {
+			log.Printf("❌ Refund of %s at %s failed: %v", transactionID, tx.Provider, err)
+			return c.Respond(&telebot.CallbackResponse{Text: "❌ Refund di gateway gagal: " + err.Error(), ShowAlert: true})
+		}
+		manual = false
+	}
+
+	revs := refundRevocations(tx)
+	err = withTransaction(ctx, func(sc mongo.SessionContext) error {
+		for i, rev := range revs {
+			if err := revokeVIPDays(sc, rev.TelegramID, rev.Days); err != nil {
+				return err
+			}
+			note := models.GrantNotePurchase
+			if rev.Referral {
+				note = models.GrantNoteReferral
+			}
+			err := recordGrant(sc, models.VIPGrant{
+				TelegramID:    rev.TelegramID,
+				Type:          models.GrantRevoked,
+				Days:          -rev.Days,
+				TransactionID: tx.TransactionID,
+				Note:          note,
+			})
+			if err != nil {
+				return err
+			}
+			if rev.Referral {
+				// Tidak menunggu saldo cukup: bonus yang sudah dicairkan
+				// menjadi utang, dilaporkan di bawah
+				err = adjustReferralBalance(sc, models.ReferralLedgerEntry{
+					TelegramID:    rev.TelegramID,
+					Type:          models.LedgerBonusRevoked,
+					Amount:        -rev.Days * models.ReferralPayoutRate,
+					Days:          rev.Days,
+					TransactionID: tx.TransactionID,
+				}, false)
+				if err != nil {
+					return err
+				}
+				var referrer models.User
+				if err := database.GetUserCollection().FindOne(sc, bson.M{"telegram_user_id": rev.TelegramID}).Decode(&referrer); err != nil {
+					return err
+				}
+				revs[i].Debt = 0
+				if referrer.ReferralBalance < 0 {
+					revs[i].Debt = -referrer.ReferralBalance
+				}
+			}
+		}
+		now := GetJakartaTime()
+		set := bson.M{"refunded_at": now}
+		if tx.ReferralHold != nil && tx.ReferralHold.Status == models.ReferralHoldPending {
+			// Bonus yang ditahan tidak pernah diberikan, jadi cukup ditutup
+			set["referral_hold.status"] = models.ReferralHoldRejected
+			set["referral_hold.resolved_at"] = now
+		}
+		_, err := transitionTransaction(sc, transactionID, models.StateRefunded, "refunded by owner", set)
+		return err
+	})
+	if err != nil {
+		log.Printf("❌ Failed to revoke VIP for refunded %s: %v", transactionID, err)
+		notifyOwner(c.Bot(), fmt.Sprintf("❌ Dana <code>%s</code> sudah dikembalikan tapi VIP gagal ditarik: %v", transactionID, err))
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ Gagal menarik VIP.", ShowAlert: true})
+	}
+	log.Printf("↩️ Transaction %s refunded by owner", transactionID)
+
+	p := message.NewPrinter(language.Indonesian)
+	var debts strings.Builder
+	for _, rev := range revs {
+		msg := fmt.Sprintf("↩️ Pembayaran <code>%s</code> telah direfund. Akses VIP %d hari dari transaksi ini ditarik.", transactionID, rev.Days)
+		if rev.Referral {
+			msg = fmt.Sprintf("↩️ Pembelian teman yang kamu undang direfund. Bonus referral %d hari ditarik.", rev.Days)
+		}
+		if rev.Debt > 0 {
+			msg += p.Sprintf("\n\n⚠️ Bonus ini sudah dicairkan atau sedang diajukan, jadi saldo referral kamu sekarang <b>minus Rp %d</b>. Kekurangannya dipotong dari bonus referral berikutnya.", rev.Debt)
+
+			pending, err := database.GetPayoutCollection().CountDocuments(ctx, bson.M{"telegramID": rev.TelegramID, "status": models.PayoutPending})
+			if err != nil {
+				log.Printf("⚠️ Failed to check pending payouts of %d: %v", rev.TelegramID, err)
+			}
+			debts.WriteString(p.Sprintf("\n⚠️ Saldo referral <code>%d</code> minus Rp %d", rev.TelegramID, rev.Debt))
+			if pending > 0 {
+				debts.WriteString(" — ada payout yang menunggu, periksa sebelum menyetujui (/payouts)")
+			}
+		}
+		c.Bot().Send(&telebot.User{ID: rev.TelegramID}, msg, telebot.ModeHTML)
+	}
+	if len(revs) == 0 || revs[0].TelegramID != tx.TelegramID {
+		c.Bot().Send(&telebot.User{ID: tx.TelegramID}, fmt.Sprintf("↩️ Pembayaran <code>%s</code> telah direfund.", transactionID), telebot.ModeHTML)
+	}
+
+	result := fmt.Sprintf("✅ <code>%s</code> direfund.", transactionID)
+	if manual {
+		result += "\n⚠️ Jangan lupa kembalikan dana " + formatAmount(tx.Currency, tx.PaidAmount) + " secara manual."
+	}
+	result += debts.String()
+	_ = c.Respond()
+	return c.Edit(result, telebot.ModeHTML)
+}
+
+// revokeVIPDays shortens a user's VIP by days, ending it when nothing is
+// left.
+func revokeVIPDays(sc mongo.SessionContext, telegramID int64, days int) error {
+	if days <= 0 {
+		return nil
+	}
+	now := GetJakartaTime()
+	_, err := database.GetUserCollection().UpdateOne(sc,
+		bson.M{"telegram_user_id": telegramID, "expire_time": bson.M{"$ne": nil}},
+		mongo.Pipeline{
+			{{Key: "$set", Value: bson.D{
+				{Key: "expire_time", Value: bson.D{{Key: "$dateAdd", Value: bson.D{
+					{Key: "startDate", Value: "$expire_time"},
+					{Key: "unit", Value: "day"},
+					{Key: "amount", Value: -days},
+				}}}},
+			}}},
+			{{Key: "$set", Value: bson.D{
+				{Key: "is_vip", Value: bson.D{{Key: "$gt", Value: bson.A{"$expire_time", now}}}},
+				{Key: "expire_time", Value: bson.D{{Key: "$cond", Value: bson.A{
+					bson.D{{Key: "$gt", Value: bson.A{"$expire_time", now}}},
+					"$expire_time",
+					nil,
+				}}}},
+			}}},
+		},
+	)
+	return err
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"gopkg.in/telebot.v3"
+
+	"transferin-drama/database"
+	"transferin-drama/models"
+)
+
+// reminderBatch bounds how many users one scheduler run handles per stage.
+const reminderBatch = 500
+
+var reminderStages = []struct {
+	Stage  int
+	Before time.Duration
+	Text   string
+}{
+	// Tahap paling akhir dulu, supaya user yang baru terjaring langsung
+	// mendapat pengingat yang paling relevan saja.
+	{models.Reminder1h, time.Hour, "⏰ <b>VIP kamu berakhir kurang dari 1 jam lagi!</b>"},
+	{models.Reminder24h, 24 * time.Hour, "⏳ <b>VIP kamu berakhir dalam 24 jam.</b>"},
+}
+
+// reminderResetStage is appended to pipelines that extend expire_time. It
+// ties the reminder state to the new expiry and skips stages the new expiry
+// is already inside of, so a 1-day package is not reminded right after
+// purchase.
+func reminderResetStage(now time.Time) bson.D {
+	return bson.D{{Key: "$set", Value: bson.D{
+		{Key: "reminded_for", Value: "$expire_time"},
+		{Key: "reminded_stage", Value: bson.D{{Key: "$switch", Value: bson.D{
+			{Key: "branches", Value: bson.A{
+				bson.D{
+					{Key: "case", Value: bson.D{{Key: "$lte", Value: bson.A{"$expire_time", now.Add(time.Hour)}}}},
+					{Key: "then", Value: models.Reminder1h},
+				},
+				bson.D{
+					{Key: "case", Value: bson.D{{Key: "$lte", Value: bson.A{"$expire_time", now.Add(24 * time.Hour)}}}},
+					{Key: "then", Value: models.Reminder24h},
+				},
+			}},
+			{Key: "default", Value: models.ReminderNone},
+		}}}},
+	}}}
+}
+
+// startReminderScheduler warns VIP users before their VIP expires. The
+// final message is sent by the expiry sweeper.
+func startReminderScheduler(ctx context.Context, n *notifier, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	log.Printf("✅ VIP reminder scheduler started (every %s)", interval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("🛑 VIP reminder scheduler stopped")
+			return
+		case <-ticker.C:
+			sendExpiryReminders(ctx, n)
+		}
+	}
+}
+
+func sendExpiryReminders(ctx context.Context, n *notifier) {
+	col := database.GetUserCollection()
+
+	for _, stage := range reminderStages {
+		now := GetJakartaTime()
+
+		findCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		cursor, err := col.Find(findCtx, bson.M{
+			"is_vip":           true,
+			"reminder_opt_out": bson.M{"$ne": true},
+			"expire_time":      bson.M{"$gt": now, "$lte": now.Add(stage.Before)},
+			"$expr": bson.M{"$or": bson.A{
+				bson.M{"$ne": bson.A{"$reminded_for", "$expire_time"}},
+				bson.M{"$lt": bson.A{bson.M{"$ifNull": bson.A{"$reminded_stage", models.ReminderNone}}, stage.Stage}},
+			}},
+		}, options.Find().SetLimit(reminderBatch))
+		var users []models.User
+		if err == nil {
+			err = cursor.All(findCtx, &users)
+		}
+		cancel()
+		if err != nil {
+			log.Printf("❌ Failed to list users to remind: %v", err)
+			return
+		}
+
+		for _, u := range users {
+			if ctx.Err() != nil {
+				return
+			}
+
+			// Tandai dulu, supaya user yang memblokir bot tidak dicoba terus
+			res, err := col.UpdateOne(ctx,
+				bson.M{"telegram_user_id": u.TelegramUserID, "expire_time": u.ExpireTime},
+				bson.M{"$set": bson.M{"reminded_for": u.ExpireTime, "reminded_stage": stage.Stage}},
+			)
+			if err != nil || res.ModifiedCount == 0 {
+				continue
+			}
+
+			msg := fmt.Sprintf("%s\n\n⏱ Berakhir: %s WIB\n\nPerpanjang sekarang supaya nonton dramanya tidak terputus. 🍿",
+				stage.Text, u.ExpireTime.Format("02-01-2006 15:04"))
+			n.send(ctx, u.TelegramUserID, msg, renewalMenu(ctx, u.TelegramUserID), telebot.ModeHTML)
+		}
+	}
+}
+
+// renewalMenu offers one-tap renewal of the user's last purchased package.
+func renewalMenu(ctx context.Context, telegramID int64) *telebot.ReplyMarkup {
+	menu := &telebot.ReplyMarkup{}
+	var rows []telebot.Row
+
+	var last models.Transaction
+	err := database.GetTransactionCollection().FindOne(ctx,
+		bson.M{
+			"telegramID":  telegramID,
+			"recipientID": bson.M{"$exists": false},
+			"state":       models.StateActivated,
+		},
+		options.FindOne().SetSort(bson.D{{Key: "activated_at", Value: -1}}),
+	).Decode(&last)
+	if err == nil {
+		if pkg, err := getPackage(ctx, last.PackageCode); err == nil && pkg.Active {
+			p := message.NewPrinter(language.Indonesian)
+			text := p.Sprintf("🔄 Perpanjang %d hari • Rp %d", pkg.Days, pkg.PriceAt(GetJakartaTime()))
+			rows = append(rows, menu.Row(menu.Data(text, "pay_vip", checkoutOrder{Package: pkg.Code}.data())))
+		}
+	}
+
+	rows = append(rows,
+		menu.Row(vipBtn),
+		menu.Row(menu.Data("🔕 Matikan pengingat", "reminder_off")),
+	)
+	menu.Inline(rows...)
+	return menu
+}
+
+// handleReminderSettings shows and toggles the VIP expiry reminders:
+//
+//	/pengingat
+func handleReminderSettings(c telebot.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	col := database.GetUserCollection()
+	if c.Callback() != nil {
+		optOut := c.Callback().Unique == "reminder_off"
+		_, err := col.UpdateOne(ctx,
+			bson.M{"telegram_user_id": c.Sender().ID},
+			bson.M{"$set": bson.M{"reminder_opt_out": optOut}},
+		)
+		if err != nil {
+			log.Println("❌ Gagal menyimpan pengaturan pengingat:", err)
+			return c.Respond(&telebot.CallbackResponse{Text: "❌ Gagal menyimpan pengaturan."})
+		}
+		_ = c.Respond()
+	}
+
+	var u models.User
+	if err := col.FindOne(ctx, bson.M{"telegram_user_id": c.Sender().ID}).Decode(&u); err != nil {
+		return c.Send("Terjadi kesalahan saat memuat status akun kamu. Coba beberapa saat lagi.")
+	}
+
+	menu := &telebot.ReplyMarkup{}
+	status := "🔔 Pengingat masa aktif VIP: <b>Aktif</b>\n\nKamu akan diingatkan 24 jam dan 1 jam sebelum VIP berakhir."
+	toggle := menu.Data("🔕 Matikan pengingat", "reminder_off")
+	if u.ReminderOptOut {
+		status = "🔕 Pengingat masa aktif VIP: <b>Nonaktif</b>"
+		toggle = menu.Data("🔔 Nyalakan pengingat", "reminder_on")
+	}
+	menu.Inline(menu.Row(toggle))
+
+	return c.Send(status, menu, telebot.ModeHTML)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/telebot.v3"
+
+	"transferin-drama/database"
+	"transferin-drama/models"
+)
+
+var reviewReasonLabels = map[string]string{
+	models.ReviewPaidAfterCancel: "dibayar setelah dibatalkan",
+	models.ReviewUnderpaid:       "pembayaran kurang",
+	models.ReviewOverpaid:        "pembayaran lebih",
+	models.ReviewActivationFail:  "aktivasi otomatis gagal berulang kali",
+}
+
+// queueForReview records a payment that cannot be activated automatically
+// and asks the owner to approve or reject it. Extra fields in set are stored
+// with the paid state.
+func queueForReview(ctx context.Context, bot *telebot.Bot, tx *models.Transaction, paidAmount int, reason string, set bson.M) {
+	fields := bson.M{"paid_amount": paidAmount, "review": reason}
+	for k, v := range set {
+		fields[k] = v
+	}
+	_, err := transitionTransaction(ctx, tx.TransactionID, models.StatePaid, "held for review: "+reason, fields)
+	if err != nil {
+		log.Printf("❌ Failed to queue %s for review: %v", tx.TransactionID, err)
+		return
+	}
+	log.Printf("⚠️ Transaction %s held for review (%s)", tx.TransactionID, reason)
+
+	menu := &telebot.ReplyMarkup{}
+	menu.Inline(menu.Row(
+		menu.Data("✅ Aktifkan", "review_approve", tx.TransactionID),
+		menu.Data("❌ Tolak", "review_reject", tx.TransactionID),
+	))
+	notifyOwner(bot, fmt.Sprintf(
+		"⚠️ <b>Pembayaran perlu review</b>\n\n"+
+			"🧾 <code>%s</code>\n"+
+			"👤 User: <code>%d</code>\n"+
+			"📦 Paket: %s (%d hari)\n"+
+			"💲 Tagihan: %s\n"+
+			"💳 Dibayar: %s\n"+
+			"📌 Alasan: %s",
+		tx.TransactionID, tx.TelegramID, tx.PackageCode, tx.Duration, formatAmount(tx.Currency, tx.Amount), formatAmount(tx.Currency, paidAmount), reviewReasonLabels[reason],
+	), menu)
+
+	bot.Send(&telebot.User{ID: tx.TelegramID}, fmt.Sprintf(
+		"⏳ Pembayaran <code>%s</code> sudah kami terima dan sedang dicek admin.\n"+
+			"VIP kamu akan aktif setelah disetujui. 📩 Ada pertanyaan? Chat admin: @domi_nuc",
+		tx.TransactionID,
+	), telebot.ModeHTML)
+}
+
+func isOwner(c telebot.Context) bool {
+	return fmt.Sprint(c.Sender().ID) == os.Getenv("BOT_OWNER_ID")
+}
+
+// handleReview lists paid transactions waiting for an owner decision.
+func handleReview(c telebot.Context) error {
+	if !isOwner(c) {
+		return c.Send("❌ Kamu tidak punya akses ke perintah ini.")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := database.GetTransactionCollection().Find(ctx,
+		bson.M{"state": models.StatePaid, "review": bson.M{"$nin": bson.A{"", nil}}},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}).SetLimit(20))
+	if err != nil {
+		log.Println("❌ Gagal mengambil antrean review:", err)
+		return c.Send("❌ Gagal mengambil antrean review.")
+	}
+	var txs []models.Transaction
+	if err := cursor.All(ctx, &txs); err != nil {
+		log.Println("❌ Gagal mengambil antrean review:", err)
+		return c.Send("❌ Gagal mengambil antrean review.")
+	}
+
+	if len(txs) == 0 {
+		return c.Send("✅ Tidak ada pembayaran yang perlu direview.")
+	}
+
+	menu := &telebot.ReplyMarkup{}
+	var rows []telebot.Row
+	var msg strings.Builder
+	msg.WriteString("⚠️ <b>Antrean Review Pembayaran</b>\n\n")
+	for _, tx := range txs {
+		msg.WriteString(fmt.Sprintf("🧾 <code>%s</code>\n👤 <code>%d</code> • %s\n💲 %s → 💳 %s\n📌 %s\n\n",
+			tx.TransactionID, tx.TelegramID, tx.PackageCode, formatAmount(tx.Currency, tx.Amount), formatAmount(tx.Currency, tx.PaidAmount), reviewReasonLabels[tx.Review]))
+		rows = append(rows, menu.Row(
+			menu.Data("✅ "+tx.TransactionID, "review_approve", tx.TransactionID),
+			menu.Data("❌", "review_reject", tx.TransactionID),
+		))
+	}
+	menu.Inline(rows...)
+	return c.Send(msg.String(), menu, telebot.ModeHTML)
+}
+
+// handleReviewApprove grants the recorded package for a reviewed payment.
+func handleReviewApprove(c telebot.Context) error {
+	if !isOwner(c) {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ Kamu tidak punya akses."})
+	}
+	transactionID := c.Data()
+
+	lock := getPaymentLock(transactionID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := getTransaction(ctx, transactionID)
+	if err != nil || tx.State != models.StatePaid || tx.Review == "" {
+		return c.Respond(&telebot.CallbackResponse{Text: "⚠️ Transaksi ini sudah tidak dalam antrean review."})
+	}
+
+	var result *activation
+	err = withTransaction(ctx, func(sc mongo.SessionContext) error {
+		result, err = grantTransaction(sc, tx, bson.M{
+			"review":            "",
+			"review_resolution": models.ReviewApproved,
+		})
+		return err
+	})
+	if err != nil {
+		log.Printf("❌ Failed to approve %s: %v", transactionID, err)
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ Gagal mengaktifkan VIP."})
+	}
+
+	result.notify(c.Bot())
+	log.Printf("✅ Review approved for %s (user %d, %d hari)", transactionID, tx.TelegramID, result.duration)
+
+	_ = c.Respond(&telebot.CallbackResponse{Text: "✅ VIP diaktifkan."})
+	return c.Edit(fmt.Sprintf("✅ <code>%s</code> disetujui, VIP %d hari diaktifkan.", transactionID, result.duration), telebot.ModeHTML)
+}
+
+// handleReviewReject closes a reviewed payment without granting VIP; the
+// refund itself is handled by the admin outside the bot.
+func handleReviewReject(c telebot.Context) error {
+	if !isOwner(c) {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ Kamu tidak punya akses."})
+	}
+	transactionID := c.Data()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var tx models.Transaction
+	err := database.GetTransactionCollection().FindOneAndUpdate(ctx,
+		bson.M{"transactionID": transactionID, "state": models.StatePaid, "review": bson.M{"$nin": bson.A{"", nil}}},
+		bson.M{
+			"$set": bson.M{
+				"review":            "",
+				"review_resolution": models.ReviewRejected,
+				"updated_at":        GetJakartaTime(),
+			},
+		},
+	).Decode(&tx)
+	if err != nil {
+		return c.Respond(&telebot.CallbackResponse{Text: "⚠️ Transaksi ini sudah tidak dalam antrean review."})
+	}
+
+	c.Bot().Send(&telebot.User{ID: tx.TelegramID}, fmt.Sprintf(
+		"ℹ️ Pembayaran <code>%s</code> tidak dapat diproses otomatis.\n"+
+			"Admin akan menghubungi kamu untuk pengembalian dana. 📩 @domi_nuc",
+		transactionID,
+	), telebot.ModeHTML)
+
+	_ = c.Respond(&telebot.CallbackResponse{Text: "❌ Ditolak."})
+	return c.Edit(fmt.Sprintf("❌ <code>%s</code> ditolak. User diminta menghubungi admin untuk refund.", transactionID), telebot.ModeHTML)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/telebot.v3"
+
+	"transferin-drama/database"
+	"transferin-drama/models"
+)
+
+const (
+	searchPageSize = 8
+	// searchQueryMaxLen keeps the query small enough to travel in the
+	// callback data of the page buttons.
+	searchQueryMaxLen = 40
+)
+
+// searchProjection is what a search result needs to be listed in the bot or
+// shared inline.
+var searchProjection = bson.M{"title": 1, "slug": 1, "total_part": 1, "cast": 1, "tag": 1, "cover": 1}
+
+// cleanSearchQuery trims a query to searchQueryMaxLen bytes without cutting
+// a character in half.
+func cleanSearchQuery(q string) string {
+	q = strings.Join(strings.Fields(q), " ")
+	for len(q) > searchQueryMaxLen {
+		_, size := utf8.DecodeLastRuneInString(q)
+		q = q[:len(q)-size]
+	}
+	return strings.TrimSpace(q)
+}
+
+// searchDramas ranks dramas by the text index over title, keywords, cast
+// and tags. The index has no language, so Indonesian words are matched as
+// typed, ignoring case and accents. When no whole word matches it falls back
+// to a title substring match, so partial titles still find something.
+func searchDramas(ctx context.Context, query string, page, pageSize int) ([]models.Drama, int64, error) {
+	col := database.GetDramaCollection()
+
+	projection := bson.M{"score": bson.M{"$meta": "textScore"}}
+	for k, v := range searchProjection {
+		projection[k] = v
+	}
+	filter := bson.M{"$text": bson.M{"$search": query}}
+	findOpts := options.Find().
+		SetProjection(projection).
+		SetSort(bson.D{{Key: "score", Value: bson.M{"$meta": "textScore"}}, {Key: "title", Value: 1}})
+
+	total, err := col.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	if total == 0 {
+		filter = bson.M{"title": primitive.Regex{Pattern: regexp.QuoteMeta(query), Options: "i"}}
+		findOpts = options.Find().
+			SetProjection(searchProjection).
+			SetSort(bson.D{{Key: "title", Value: 1}})
+		if total, err = col.CountDocuments(ctx, filter); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	cursor, err := col.Find(ctx, filter, findOpts.
+		SetSkip(int64(page*pageSize)).
+		SetLimit(int64(pageSize)))
+	if err != nil {
+		return nil, 0, err
+	}
+	var dramas []models.Drama
+	if err := cursor.All(ctx, &dramas); err != nil {
+		return nil, 0, err
+	}
+	return dramas, total, nil
+}
+
+// handleSearch searches the hosted dramas:
+//
+//	/search <judul, pemeran atau tag>
+func handleSearch(c telebot.Context) error {
+	query := cleanSearchQuery(c.Message().Payload)
+	if query == "" {
+		if err := startConversation(c.Sender().ID, flowSearch, "", nil); err != nil {
+			return c.Send("❌ Terjadi kesalahan. Coba beberapa saat lagi.")
+		}
+		return conversationPrompt(c, "🔍 Ketik judul, pemeran atau tag drama yang kamu cari.")
+	}
+	return showSearchResults(c, query, 0)
+}
+
+func handleSearchText(c telebot.Context, conv *models.Conversation) error {
+	return showSearchResults(c, cleanSearchQuery(c.Text()), 0)
+}
+
+// handleSearchPage turns the page of a search result.
+func handleSearchPage(c telebot.Context) error {
+	_ = c.Respond()
+	pageData, query, _ := strings.Cut(c.Data(), "|")
+	page, _ := strconv.Atoi(pageData)
+	return showSearchResults(c, query, page)
+}
+
+func showSearchResults(c telebot.Context, query string, page int) error {
+	if query == "" {
+		return c.Send("🔍 Ketik judul, pemeran atau tag drama yang kamu cari.")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dramas, total, err := searchDramas(ctx, query, page, searchPageSize)
+	if err != nil {
+		log.Println("❌ Gagal mencari drama:", err)
+		return c.Send("❌ Pencarian gagal. Coba beberapa saat lagi.")
+	}
+
+	menu := &telebot.ReplyMarkup{}
+	var rows []telebot.Row
+	for _, d := range dramas {
+		rows = append(rows, menu.Row(
+			menu.Data(fmt.Sprintf("▶️ %s", d.Title), "drama_part", d.ID.Hex()+"|1"),
+			menu.Data("📋", "drama", d.ID.Hex()),
+		))
+	}
+	pages := int((total + searchPageSize - 1) / searchPageSize)
+	if nav := pageNav(menu, "search_page", page, pages, func(page int) string {
+		return fmt.Sprintf("%d|%s", page, query)
+	}); nav != nil {
+		rows = append(rows, nav)
+	}
+	rows = append(rows, menu.Row(menu.Data("🎬 Katalog", "catalog", catalogQuery{Sort: catalogNewest}.data())))
+	menu.Inline(rows...)
+
+	msg := fmt.Sprintf("🔍 Hasil pencarian <b>%s</b>: %d drama\n\n▶️ langsung nonton part 1 • 📋 lihat semua part", html.EscapeString(query), total)
+	if total == 0 {
+		msg = fmt.Sprintf("🔍 Tidak ada drama yang cocok dengan <b>%s</b>.\n\nCoba kata kunci lain, atau jelajahi katalog.", html.EscapeString(query))
+	}
+
+	if c.Callback() != nil {
+		return c.Edit(msg, menu, telebot.ModeHTML)
+	}
+	return c.Send(msg, menu, telebot.ModeHTML)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"gopkg.in/telebot.v3"
+
+	"transferin-drama/models"
+)
+
+const (
+	// starsProvider is the ledger provider name of Telegram Stars payments.
+	starsProvider = "telegram_stars"
+
+	// starsInvoiceTTL bounds how long a Stars invoice can be paid; the
+	// reconciler expires the transaction afterwards.
+	starsInvoiceTTL = time.Hour
+
+	defaultStarsIDRRate = 250
+)
+
+// starsIDRRate is how many Rupiah one Star is worth for packages without an
+// explicit Stars price. Overridable with STARS_IDR_RATE.
+func starsIDRRate() int {
+	if rate, err := strconv.Atoi(os.Getenv("STARS_IDR_RATE")); err == nil && rate > 0 {
+		return rate
+	}
+	return defaultStarsIDRRate
+}
+
+// handlePayStars sends a Telegram Stars invoice for a checkout order.
+func handlePayStars(c telebot.Context) error {
+	_ = c.Respond()
+
+	order := parseCheckoutOrder(c.Data())
+	user := c.Sender()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	pkg, err := getPackage(ctx, order.Package)
+	if err != nil || !pkg.Active {
+		return c.Send("❌ Paket VIP tidak ditemukan.")
+	}
+
+	recipient, err := orderRecipient(ctx, order, user.ID)
+	if err != nil {
+		return c.Send(giftRecipientErrorText(err))
+	}
+
+	price := pkg.StarsPriceAt(GetJakartaTime(), starsIDRRate())
+	amount := price
+	voucherDays := 0
+	if order.Voucher != "" {
+		voucher, err := redeemVoucher(ctx, order.Voucher, pkg.Code, user.ID)
+		if err != nil {
+			return c.Send(voucherErrorText(err))
+		}
+		amount, voucherDays = voucher.ApplyStars(price, starsIDRRate(), 1)
+	}
+
+	transactionID := generateTransactionID()
+	tx := &models.Transaction{
+		TransactionID: transactionID,
+		TelegramID:    user.ID,
+		RecipientID:   order.Recipient,
+		Provider:      starsProvider,
+		Currency:      models.CurrencyStars,
+		PackageCode:   pkg.Code,
+		Amount:        amount,
+		Duration:      pkg.Days,
+	}
+	if order.Voucher != "" {
+		tx.VoucherCode = order.Voucher
+		tx.Discount = price - amount
+		tx.VoucherDays = voucherDays
+	}
+	if err := createTransaction(ctx, tx); err != nil {
+		log.Printf("❌ Failed to create transaction %s: %v", transactionID, err)
+		releaseVoucher(ctx, tx)
+		return c.Send("❌ Gagal membuat tagihan. Silakan coba lagi nanti.")
+	}
+
+	description := fmt.Sprintf("Akses semua drama tanpa batas selama %d hari.", pkg.Days+voucherDays)
+	if recipient != nil {
+		description = fmt.Sprintf("Hadiah VIP %d hari untuk %s.", pkg.Days+voucherDays, giftRecipientName(recipient))
+	}
+	invoice := &telebot.Invoice{
+		Title:       pkg.Label,
+		Description: description,
+		Payload:     transactionID,
+		Currency:    models.CurrencyStars,
+		Prices:      []telebot.Price{{Label: pkg.Label, Amount: amount}},
+	}
+
+	_, err = transitionTransaction(ctx, transactionID, models.StateAwaitingPayment, "", bson.M{"expired_at": GetJakartaTime().Add(starsInvoiceTTL)})
+	if err == nil {
+		_, err = c.Bot().Send(c.Chat(), invoice)
+	}
+	if err != nil {
+		log.Printf("❌ Failed to send Stars invoice %s: %v", transactionID, err)
+		if cancelled, terr := transitionTransaction(ctx, transactionID, models.StateCancelled, "invoice creation failed", nil); terr == nil {
+			releaseVoucher(ctx, cancelled)
+		}
+		return c.Send("❌ Gagal membuat tagihan. Silakan coba lagi nanti.")
+	}
+	log.Printf("✅ Created Stars transaction for user %d: %s", user.ID, transactionID)
+	return nil
+}
+
+// handleStarsPreCheckout only lets Telegram charge the user for an open
+// invoice whose price still matches the ledger.
+func handleStarsPreCheckout(c telebot.Context) error {
+	q := c.PreCheckoutQuery()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := getTransaction(ctx, q.Payload)
+	if err != nil || tx.Provider != starsProvider || tx.State != models.StateAwaitingPayment ||
+		q.Currency != models.CurrencyStars || q.Total != tx.Amount || q.Sender.ID != tx.TelegramID ||
+		GetJakartaTime().After(tx.ExpiredAt) {
+		log.Printf("⚠️ Rejected Stars pre-checkout for %s from %d: %v", q.Payload, q.Sender.ID, err)
+		return c.Accept("Tagihan sudah tidak berlaku. Silakan buat tagihan baru lewat /vip.")
+	}
+	return c.Accept()
+}
+
+// handleStarsPayment activates VIP once Telegram reports a successful Stars
+// payment, through the same path as a verified QRIS webhook.
+func handleStarsPayment(c telebot.Context) error {
+	pay := c.Message().Payment
+	if pay == nil || pay.Currency != models.CurrencyStars {
+		return nil
+	}
+
+	lock := getPaymentLock(pay.Payload)
+	lock.Lock()
+	defer lock.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := getTransaction(ctx, pay.Payload)
+	if err == nil && !tx.State.CanTransition(models.StatePaid) {
+		err = fmt.Errorf("transaction is already %s", tx.State)
+	}
+	if err == nil {
+		err = completePayment(ctx, c.Bot(), tx, pay.Total, "paid with Telegram Stars", bson.M{
+			"telegram_charge_id": pay.TelegramChargeID,
+		})
+	}
+	if err != nil && !errors.Is(err, errNeedsReview) {
+		log.Printf("❌ Failed to activate Stars payment %s (%s): %v", pay.Payload, pay.TelegramChargeID, err)
+		notifyOwner(c.Bot(), fmt.Sprintf(
+			"❌ <b>Pembayaran Stars gagal diaktifkan</b>\n\n🧾 <code>%s</code>\n👤 <code>%d</code>\n⭐ %d\n🔖 <code>%s</code>",
+			pay.Payload, c.Sender().ID, pay.Total, pay.TelegramChargeID,
+		))
+		return c.Send("⚠️ Pembayaran kamu sudah kami terima, tapi VIP belum bisa diaktifkan otomatis. Admin akan segera mengeceknya. 📩 @domi_nuc")
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// startKind is what a /start payload asks the bot to do.
+type startKind int
+
+const (
+	startHome     startKind = iota // tanpa payload: sambutan biasa
+	startVideo                     // <slug>_part_<n> dari postingan channel
+	startReferral                  // ref_<kode>
+	startCampaign                  // src_<sumber>, untuk melacak kampanye
+)
+
+// startPayload is a parsed /start payload.
+type startPayload struct {
+	Kind  startKind
+	Value string
+}
+
+// startRoutes are the prefixed payloads. Values never contain an underscore,
+// so they cannot be mistaken for video slugs, which always end in
+// "_part_<n>". New campaign payloads get a prefix here.
+var startRoutes = []struct {
+	Prefix  string
+	Kind    startKind
+	Pattern *regexp.Regexp
+}{
+	{referralStartPrefix, startReferral, regexp.MustCompile(`^[0-9A-Za-z]{4,32}$`)},
+	{"src_", startCampaign, regexp.MustCompile(`^[0-9a-z-]{1,32}$`)},
+}
+
+// parseStartPayload routes a /start payload by prefix. Anything that is not
+// a known prefixed payload is treated as a video slug, as before.
+func parseStartPayload(payload string) startPayload {
+	if payload == "" {
+		return startPayload{Kind: startHome}
+	}
+	for _, route := range startRoutes {
+		value, ok := strings.CutPrefix(payload, route.Prefix)
+		if ok && route.Pattern.MatchString(value) {
+			return startPayload{Kind: route.Kind, Value: value}
+		}
+	}
+	return startPayload{Kind: startVideo, Value: payload}
+}
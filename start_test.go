@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestParseStartPayload(t *testing.T) {
+	tests := []struct {
+		payload string
+		want    startPayload
+	}{
+		{"", startPayload{Kind: startHome}},
+		{"ref_AB12cd34", startPayload{Kind: startReferral, Value: "AB12cd34"}},
+		{"src_tiktok-ads", startPayload{Kind: startCampaign, Value: "tiktok-ads"}},
+		{"src_inline", startPayload{Kind: startCampaign, Value: "inline"}},
+		{"cinta_terlarang_part_3", startPayload{Kind: startVideo, Value: "cinta_terlarang_part_3"}},
+		// Nilai yang tidak cocok dengan pola rute jatuh ke slug video
+		{"ref_abc", startPayload{Kind: startVideo, Value: "ref_abc"}},
+		{"ref_ab_part_1", startPayload{Kind: startVideo, Value: "ref_ab_part_1"}},
+		{"src_Promo", startPayload{Kind: startVideo, Value: "src_Promo"}},
+		{"src_", startPayload{Kind: startVideo, Value: "src_"}},
+	}
+	for _, tt := range tests {
+		if got := parseStartPayload(tt.payload); got != tt.want {
+			t.Errorf("parseStartPayload(%q) = %+v, want %+v", tt.payload, got, tt.want)
+		}
+	}
+}
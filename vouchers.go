@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"gopkg.in/telebot.v3"
+
+	"transferin-drama/database"
+	"transferin-drama/models"
+)
+
+// voucherMinAmount is the lowest invoice a discount may produce; QRIS cannot
+// bill nothing.
+const voucherMinAmount = 1000
+
+var (
+	errVoucherNotFound    = errors.New("voucher not found")
+	errVoucherExpired     = errors.New("voucher expired")
+	errVoucherNotEligible = errors.New("voucher not valid for package")
+	errVoucherExhausted   = errors.New("voucher usage limit reached")
+	errVoucherUserLimit   = errors.New("voucher per-user limit reached")
+)
+
+var voucherCodePattern = regexp.MustCompile(`^[A-Z0-9_-]{3,20}$`)
+
+func voucherErrorText(err error) string {
+	switch {
+	case errors.Is(err, errVoucherNotFound):
+		return "❌ Kode voucher tidak ditemukan."
+	case errors.Is(err, errVoucherExpired):
+		return "⌛ Kode voucher sudah tidak berlaku."
+	case errors.Is(err, errVoucherNotEligible):
+		return "❌ Kode voucher tidak berlaku untuk paket ini."
+	case errors.Is(err, errVoucherExhausted):
+		return "😔 Kuota voucher sudah habis."
+	case errors.Is(err, errVoucherUserLimit):
+		return "⚠️ Kamu sudah memakai voucher ini."
+	}
+	return "❌ Gagal memeriksa voucher. Coba lagi nanti."
+}
+
+// checkVoucher validates code for a purchase of packageCode by telegramID
+// without using it up. Its per-user count is only a read; redeemVoucher
+// enforces the limit atomically.
+func checkVoucher(ctx context.Context, code, packageCode string, telegramID int64) (*models.Voucher, error) {
+	var v models.Voucher
+	err := database.GetVoucherCollection().FindOne(ctx, bson.M{"code": code, "active": true}).Decode(&v)
+	if err == mongo.ErrNoDocuments {
+		return nil, errVoucherNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !GetJakartaTime().Before(v.ExpiresAt) {
+		return nil, errVoucherExpired
+	}
+	if !v.Eligible(packageCode) {
+		return nil, errVoucherNotEligible
+	}
+	if v.MaxUses > 0 && v.Used >= v.MaxUses {
+		return nil, errVoucherExhausted
+	}
+	if v.PerUserLimit > 0 {
+		used, err := database.GetTransactionCollection().CountDocuments(ctx, bson.M{
+			"voucher_code": code,
+			"telegramID":   telegramID,
+			"state":        bson.M{"$nin": bson.A{models.StateCancelled, models.StateExpired}},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if int(used) >= v.PerUserLimit {
+			return nil, errVoucherUserLimit
+		}
+	}
+	return &v, nil
+}
+
+// takeUserRedemption takes one of telegramID's uses of a voucher. The limit
+// is in the filter of an upsert on a document unique per code and user: when
+// the user is at the limit the filter misses and the insert hits the unique
+// index, so concurrent checkouts by one user cannot both pass.
+func takeUserRedemption(ctx context.Context, code string, telegramID int64, limit int) error {
+	_, err := database.GetVoucherRedemptionCollection().UpdateOne(ctx,
+		bson.M{"code": code, "telegramID": telegramID, "used": bson.M{"$lt": limit}},
+		bson.M{"$inc": bson.M{"used": 1}, "$set": bson.M{"updated_at": GetJakartaTime()}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return errVoucherUserLimit
+	}
+	return err
+}
+
+// releaseUserRedemption gives back a use taken by takeUserRedemption.
+func releaseUserRedemption(ctx context.Context, code string, telegramID int64) error {
+	_, err := database.GetVoucherRedemptionCollection().UpdateOne(ctx,
+		bson.M{"code": code, "telegramID": telegramID, "used": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"used": -1}, "$set": bson.M{"updated_at": GetJakartaTime()}},
+	)
+	return err
+}
+
+// redeemVoucher checks the voucher and takes one use of it. The usage limits
+// are part of the update filters, so concurrent checkouts cannot overshoot
+// them.
+func redeemVoucher(ctx context.Context, code, packageCode string, telegramID int64) (*models.Voucher, error) {
+	checked, err := checkVoucher(ctx, code, packageCode, telegramID)
+	if err != nil {
+		return nil, err
+	}
+	if checked.PerUserLimit > 0 {
+		if err := takeUserRedemption(ctx, code, telegramID, checked.PerUserLimit); err != nil {
+			return nil, err
+		}
+	}
+
+	var v models.Voucher
+	err = database.GetVoucherCollection().FindOneAndUpdate(ctx,
+		bson.M{
+			"code":       code,
+			"active":     true,
+			"expires_at": bson.M{"$gt": GetJakartaTime()},
+			"$or": bson.A{
+				bson.M{"max_uses": 0},
+				bson.M{"$expr": bson.M{"$lt": bson.A{"$used", "$max_uses"}}},
+			},
+		},
+		bson.M{"$inc": bson.M{"used": 1}, "$set": bson.M{"updated_at": GetJakartaTime()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&v)
+	if err != nil && checked.PerUserLimit > 0 {
+		if rerr := releaseUserRedemption(ctx, code, telegramID); rerr != nil {
+			log.Printf("⚠️ Failed to release voucher %s for %d: %v", code, telegramID, rerr)
+		}
+	}
+	if err == mongo.ErrNoDocuments {
+		return nil, errVoucherExhausted
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// releaseVoucher gives back the use taken by a transaction that was
+// cancelled or expired before being paid.
+func releaseVoucher(ctx context.Context, tx *models.Transaction) {
+	if tx == nil || tx.VoucherCode == "" {
+		return
+	}
+	_, err := database.GetVoucherCollection().UpdateOne(ctx,
+		bson.M{"code": tx.VoucherCode, "used": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"used": -1}, "$set": bson.M{"updated_at": GetJakartaTime()}},
+	)
+	if err != nil {
+		log.Printf("⚠️ Failed to release voucher %s for %s: %v", tx.VoucherCode, tx.TransactionID, err)
+	}
+	// Tanpa batas per user tidak ada dokumen; update yang tidak cocok aman
+	if err := releaseUserRedemption(ctx, tx.VoucherCode, tx.TelegramID); err != nil {
+		log.Printf("⚠️ Failed to release voucher %s of %d for %s: %v", tx.VoucherCode, tx.TelegramID, tx.TransactionID, err)
+	}
+}
+
+// handleVoucherAdmin lets the owner manage voucher codes:
+//
+//	/voucher
+//	/voucher add <kode> <percent|fixed|days> <nilai> <kuota> <per_user> <jam> [paket,paket]
+//	/voucher disable|enable <kode>
+func handleVoucherAdmin(c telebot.Context) error {
+	if !isOwner(c) {
+		return c.Send("❌ Kamu tidak punya akses ke perintah ini.")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	args := c.Args()
+	usage := "⚠️ Format salah!\n" +
+		"<code>/voucher</code>\n" +
+		"<code>/voucher add HEMAT10 percent 10 100 1 72</code>\n" +
+		"<code>/voucher add POTONG2K fixed 2000 50 1 24 vip_7d,vip_30d</code>\n" +
+		"<code>/voucher add BONUS3 days 3 0 1 168</code>\n" +
+		"<code>/voucher disable HEMAT10</code>\n" +
+		"<code>/voucher enable HEMAT10</code>\n\n" +
+		"Kuota / per_user 0 = tanpa batas."
+
+	if len(args) == 0 || args[0] == "list" {
+		return c.Send(listVouchersText(ctx), telebot.ModeHTML)
+	}
+
+	col := database.GetVoucherCollection()
+	now := GetJakartaTime()
+
+	switch args[0] {
+	case "add":
+		if len(args) < 7 || len(args) > 8 {
+			return c.Send(usage, telebot.ModeHTML)
+		}
+		code := strings.ToUpper(args[1])
+		if !voucherCodePattern.MatchString(code) {
+			return c.Send("⚠️ Kode voucher hanya boleh huruf, angka, _ atau -, 3-20 karakter.")
+		}
+		types := map[string]string{
+			"percent": models.VoucherPercent,
+			"fixed":   models.VoucherFixed,
+			"days":    models.VoucherBonusDays,
+		}
+		voucherType, ok := types[args[2]]
+		if !ok {
+			return c.Send(usage, telebot.ModeHTML)
+		}
+		value, err := strconv.Atoi(args[3])
+		if err != nil || value <= 0 || (voucherType == models.VoucherPercent && value >= 100) {
+			return c.Send("⚠️ Nilai voucher tidak valid.")
+		}
+		maxUses, err := strconv.Atoi(args[4])
+		if err != nil || maxUses < 0 {
+			return c.Send("⚠️ Kuota tidak valid.")
+		}
+		perUser, err := strconv.Atoi(args[5])
+		if err != nil || perUser < 0 {
+			return c.Send("⚠️ Batas per user tidak valid.")
+		}
+		hours, err := strconv.Atoi(args[6])
+		if err != nil || hours <= 0 {
+			return c.Send("⚠️ Masa berlaku (jam) tidak valid.")
+		}
+		var packages []string
+		if len(args) == 8 {
+			for _, code := range strings.Split(args[7], ",") {
+				if _, err := getPackage(ctx, code); err != nil {
+					return c.Send(fmt.Sprintf("❌ Paket <code>%s</code> tidak ditemukan.", code), telebot.ModeHTML)
+				}
+				packages = append(packages, code)
+			}
+		}
+
+		_, err = col.InsertOne(ctx, models.Voucher{
+			Code:         code,
+			Type:         voucherType,
+			Value:        value,
+			MaxUses:      maxUses,
+			PerUserLimit: perUser,
+			Packages:     packages,
+			ExpiresAt:    now.Add(time.Duration(hours) * time.Hour),
+			Active:       true,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		})
+		if mongo.IsDuplicateKeyError(err) {
+			return c.Send("❌ Kode voucher sudah ada.")
+		}
+		if err != nil {
+			log.Println("❌ Gagal menyimpan voucher:", err)
+			return c.Send("❌ Gagal menyimpan voucher.")
+		}
+		return c.Send(fmt.Sprintf("✅ Voucher <code>%s</code> dibuat.\n\n%s", code, listVouchersText(ctx)), telebot.ModeHTML)
+
+	case "disable", "enable":
+		if len(args) != 2 {
+			return c.Send(usage, telebot.ModeHTML)
+		}
+		res, err := col.UpdateOne(ctx,
+			bson.M{"code": strings.ToUpper(args[1])},
+			bson.M{"$set": bson.M{"active": args[0] == "enable", "updated_at": now}},
+		)
+		if err != nil {
+			return c.Send("❌ Gagal memperbarui voucher.")
+		}
+		if res.MatchedCount == 0 {
+			return c.Send("❌ Voucher tidak ditemukan.")
+		}
+		return c.Send(listVouchersText(ctx), telebot.ModeHTML)
+	}
+
+	return c.Send(usage, telebot.ModeHTML)
+}
+
+func listVouchersText(ctx context.Context) string {
+	cursor, err := database.GetVoucherCollection().Find(ctx, bson.M{},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(30))
+	if err != nil {
+		log.Println("❌ Gagal mengambil voucher:", err)
+		return "❌ Gagal mengambil daftar voucher."
+	}
+	var vouchers []models.Voucher
+	if err := cursor.All(ctx, &vouchers); err != nil {
+		log.Println("❌ Gagal mengambil voucher:", err)
+		return "❌ Gagal mengambil daftar voucher."
+	}
+
+	// Jumlah pembelian yang benar-benar lunas per voucher
+	paid := make(map[string]int)
+	cursor, err = database.GetTransactionCollection().Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"voucher_code": bson.M{"$exists": true},
+			"state":        bson.M{"$in": bson.A{models.StatePaid, models.StateActivated}},
+		}}},
+		{{Key: "$group", Value: bson.M{"_id": "$voucher_code", "count": bson.M{"$sum": 1}}}},
+	})
+	if err == nil {
+		var rows []struct {
+			Code  string `bson:"_id"`
+			Count int    `bson:"count"`
+		}
+		if err := cursor.All(ctx, &rows); err == nil {
+			for _, row := range rows {
+				paid[row.Code] = row.Count
+			}
+		}
+	}
+
+	p := message.NewPrinter(language.Indonesian)
+	now := GetJakartaTime()
+
+	var msg strings.Builder
+	msg.WriteString("🎟️ <b>Daftar Voucher</b>\n\n")
+	for _, v := range vouchers {
+		status := "✅"
+		if !v.Active || !now.Before(v.ExpiresAt) {
+			status = "🚫"
+		}
+
+		var value string
+		switch v.Type {
+		case models.VoucherPercent:
+			value = fmt.Sprintf("-%d%%", v.Value)
+		case models.VoucherFixed:
+			value = p.Sprintf("-Rp %d", v.Value)
+		case models.VoucherBonusDays:
+			value = fmt.Sprintf("+%d hari", v.Value)
+		}
+
+		limit := "∞"
+		if v.MaxUses > 0 {
+			limit = strconv.Itoa(v.MaxUses)
+		}
+		packages := "semua paket"
+		if len(v.Packages) > 0 {
+			packages = strings.Join(v.Packages, ", ")
+		}
+
+		msg.WriteString(fmt.Sprintf("%s <code>%s</code> %s\n    dipakai %d/%s • lunas %d • per user %d\n    %s • s/d %s\n",
+			status, v.Code, value, v.Used, limit, paid[v.Code], v.PerUserLimit, packages, v.ExpiresAt.Format("02-01-2006 15:04")))
+	}
+	if len(vouchers) == 0 {
+		msg.WriteString("Belum ada voucher.")
+	}
+	return msg.String()
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/telebot.v3"
+
+	"transferin-drama/database"
+	"transferin-drama/models"
+)
+
+const (
+	continueWatchingLimit = 10
+	// continueWatchingScan is how many recent dramas are looked at to find
+	// continueWatchingLimit that are not finished yet.
+	continueWatchingScan = 50
+)
+
+var continueBtn = menu.Data("▶️ Lanjut Nonton", "continue_watch")
+
+// dramaSlugOf returns the drama a video slug ("<drama>_part_<n>") belongs
+// to.
+func dramaSlugOf(videoSlug string) string {
+	if i := strings.LastIndex(videoSlug, "_part_"); i >= 0 {
+		return videoSlug[:i]
+	}
+	return videoSlug
+}
+
+// recordWatchProgress remembers video as the part userID last watched of its
+// drama. It only logs failures: the video has already been sent.
+func recordWatchProgress(userID int64, video models.Video) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := GetJakartaTime()
+	_, err := database.GetWatchHistoryCollection().UpdateOne(ctx,
+		bson.M{"telegramID": userID, "drama_slug": dramaSlugOf(video.Slug)},
+		bson.M{
+			"$set": bson.M{
+				"last_part":  video.Part,
+				"total_part": video.TotalPart,
+				"updated_at": now,
+			},
+			"$setOnInsert": bson.M{"created_at": now},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		log.Printf("⚠️ Failed to record watch progress of %d on %s: %v", userID, video.Slug, err)
+	}
+}
+
+// inProgressDramas returns the dramas userID watched most recently and has
+// not finished, each with the part they stopped at. The drama's current
+// part count is used, so a finished drama comes back once new parts are
+// added.
+func inProgressDramas(ctx context.Context, userID int64) ([]models.Drama, []models.WatchProgress, error) {
+	cursor, err := database.GetWatchHistoryCollection().Find(ctx,
+		bson.M{"telegramID": userID},
+		options.Find().
+			SetSort(bson.D{{Key: "updated_at", Value: -1}}).
+			SetLimit(continueWatchingScan),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	var history []models.WatchProgress
+	if err := cursor.All(ctx, &history); err != nil {
+		return nil, nil, err
+	}
+	if len(history) == 0 {
+		return nil, nil, nil
+	}
+
+	slugs := make([]string, 0, len(history))
+	for _, h := range history {
+		slugs = append(slugs, h.DramaSlug)
+	}
+	cursor, err = database.GetDramaCollection().Find(ctx,
+		bson.M{"slug": bson.M{"$in": slugs}},
+		options.Find().SetProjection(bson.M{"title": 1, "slug": 1, "total_part": 1}),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	var found []models.Drama
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, nil, err
+	}
+	bySlug := make(map[string]models.Drama, len(found))
+	for _, d := range found {
+		bySlug[d.Slug] = d
+	}
+
+	var dramas []models.Drama
+	var progress []models.WatchProgress
+	for _, h := range history {
+		d, ok := bySlug[h.DramaSlug]
+		if !ok || h.LastPart >= d.TotalPart {
+			continue
+		}
+		dramas = append(dramas, d)
+		progress = append(progress, h)
+		if len(dramas) == continueWatchingLimit {
+			break
+		}
+	}
+	return dramas, progress, nil
+}
+
+// handleContinueWatching lists the dramas the user has not finished, each
+// resuming at the next part:
+//
+//	/lanjut
+func handleContinueWatching(c telebot.Context) error {
+	if c.Callback() != nil {
+		_ = c.Respond()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dramas, progress, err := inProgressDramas(ctx, c.Sender().ID)
+	if err != nil {
+		log.Println("❌ Gagal memuat riwayat tontonan:", err)
+		return c.Send("❌ Gagal memuat riwayat tontonan. Coba beberapa saat lagi.")
+	}
+
+	menu := &telebot.ReplyMarkup{}
+	var rows []telebot.Row
+	for i, d := range dramas {
+		next := progress[i].LastPart + 1
+		rows = append(rows, menu.Row(
+			menu.Data(fmt.Sprintf("▶️ %s • Part %d/%d", d.Title, next, d.TotalPart), "drama_part", fmt.Sprintf("%s|%d", d.ID.Hex(), next)),
+			menu.Data("📋", "drama", d.ID.Hex()),
+		))
+	}
+	rows = append(rows, menu.Row(menu.Data("🎬 Katalog", "catalog", catalogQuery{Sort: catalogNewest}.data())))
+	menu.Inline(rows...)
+
+	msg := "▶️ <b>Lanjut Nonton</b>\n\nTekan judul untuk melanjutkan dari part berikutnya, atau 📋 untuk memilih part."
+	if len(dramas) == 0 {
+		msg = "▶️ Belum ada drama yang sedang kamu tonton.\n\nMulai dari katalog, nanti progresnya tersimpan di sini."
+	}
+
+	if c.Callback() != nil {
+		return c.Edit(msg, menu, telebot.ModeHTML)
+	}
+	return c.Send(msg, menu, telebot.ModeHTML)
+}
@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestDramaSlugOf(t *testing.T) {
+	tests := []struct {
+		slug string
+		want string
+	}{
+		{"cinta_terlarang_part_3", "cinta_terlarang"},
+		{"cinta_terlarang_part_12", "cinta_terlarang"},
+		// Judul yang memuat "_part_" sendiri: hanya akhiran terakhir yang dibuang
+		{"the_part_time_wife_part_1", "the_part_time_wife"},
+		{"tanpa_part", "tanpa_part"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := dramaSlugOf(tt.slug); got != tt.want {
+			t.Errorf("dramaSlugOf(%q) = %q, want %q", tt.slug, got, tt.want)
+		}
+	}
+}